@@ -0,0 +1,215 @@
+/*
+Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
+*/
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	at "github.com/hleinders/AnsiTerm"
+	"github.com/hleinders/htprobe/probe"
+	"github.com/spf13/cobra"
+)
+
+type AssertFlags struct {
+	expectStatus   int
+	expectFinalURL string
+	expectHops     int
+	expectCertDays int
+	expectHeaders  []string
+}
+
+var assertFlags AssertFlags
+
+// An assertion is evaluated against the hops of a probed URL
+type assertion struct {
+	name   string
+	expect string
+	eval   func(resultList []WebRequestResult) (actual string, passed bool)
+}
+
+type AssertionResult struct {
+	Name   string `json:"name"`
+	Expect string `json:"expect"`
+	Actual string `json:"actual"`
+	Passed bool   `json:"passed"`
+}
+
+// addAssertionFlags adds the '--expect-*' flags to a subcommand
+func addAssertionFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&assertFlags.expectStatus, "expect-status", 0, "assert `status` of the last hop")
+	cmd.Flags().StringVar(&assertFlags.expectFinalURL, "expect-final-url", "", "assert `URL` of the last hop (may contain '*')")
+	cmd.Flags().IntVar(&assertFlags.expectHops, "expect-hops", -1, "assert number of redirects `N`")
+	cmd.Flags().IntVar(&assertFlags.expectCertDays, "expect-cert-days", 0, "assert certificates are valid for at least `N` days")
+	cmd.Flags().StringArrayVar(&assertFlags.expectHeaders, "expect-header", nil, "assert response header of last hop (fmt: 'name', 'name=value' or 'name~regex'); ***")
+}
+
+// makeAssertions builds the assertions for a job from the flags. A status
+// given in the url file overrides '--expect-status'.
+func makeAssertions(job urlJob) ([]assertion, error) {
+	var al []assertion
+
+	status := assertFlags.expectStatus
+	if job.expectStatus != 0 {
+		status = job.expectStatus
+	}
+
+	if status != 0 {
+		al = append(al, assertion{"status", strconv.Itoa(status), func(rl []WebRequestResult) (string, bool) {
+			actual := rl[len(rl)-1].Response.StatusCode
+			return strconv.Itoa(actual), actual == status
+		}})
+	}
+
+	if assertFlags.expectFinalURL != "" {
+		expect := assertFlags.expectFinalURL
+		al = append(al, assertion{"final url", expect, func(rl []WebRequestResult) (string, bool) {
+			actual := rl[len(rl)-1].Request.URL.String()
+			return actual, matchGlob(expect, actual)
+		}})
+	}
+
+	if assertFlags.expectHops >= 0 {
+		expect := assertFlags.expectHops
+		al = append(al, assertion{"hops", strconv.Itoa(expect), func(rl []WebRequestResult) (string, bool) {
+			actual := countRedirects(rl)
+			return strconv.Itoa(actual), actual == expect
+		}})
+	}
+
+	if assertFlags.expectCertDays > 0 {
+		days := assertFlags.expectCertDays
+		al = append(al, assertion{"cert days", fmt.Sprintf(">= %d", days), evalCertDays(days)})
+	}
+
+	for _, h := range assertFlags.expectHeaders {
+		a, err := makeHeaderAssertion(h)
+		if err != nil {
+			return al, err
+		}
+		al = append(al, a)
+	}
+
+	return al, nil
+}
+
+// countRedirects returns the number of redirects of a chain; auth retries
+// repeat a hop and are not counted
+func countRedirects(rl []WebRequestResult) int {
+	cnt := 0
+	for _, r := range rl[1:] {
+		if !r.Retry {
+			cnt++
+		}
+	}
+
+	return cnt
+}
+
+// makeHeaderAssertion parses 'name', 'name=value' or 'name~regex'
+func makeHeaderAssertion(raw string) (assertion, error) {
+	var a assertion
+
+	idx := strings.IndexAny(raw, "=~")
+	if idx < 0 {
+		name := strings.TrimSpace(raw)
+		a = assertion{"header " + name, "present", func(rl []WebRequestResult) (string, bool) {
+			values := rl[len(rl)-1].Response.Header.Values(name)
+			if len(values) == 0 {
+				return "missing", false
+			}
+			return strings.Join(values, ", "), true
+		}}
+		return a, nil
+	}
+
+	name := strings.TrimSpace(raw[:idx])
+	op := raw[idx : idx+1]
+	expect := strings.TrimSpace(raw[idx+1:])
+
+	match := func(v string) bool { return v == expect }
+	if op == "~" {
+		rx, err := regexp.Compile(expect)
+		if err != nil {
+			return a, fmt.Errorf("invalid header assertion %s: %w", raw, err)
+		}
+		match = rx.MatchString
+	}
+
+	a = assertion{"header " + name, op + " " + expect, func(rl []WebRequestResult) (string, bool) {
+		values := rl[len(rl)-1].Response.Header.Values(name)
+		if len(values) == 0 {
+			return "missing", false
+		}
+		actual := strings.Join(values, ", ")
+		return actual, match(actual)
+	}}
+
+	return a, nil
+}
+
+// evalCertDays checks the certificates of every hop done via tls
+func evalCertDays(days int) func(rl []WebRequestResult) (string, bool) {
+	return func(rl []WebRequestResult) (string, bool) {
+		minDays := -1
+
+		for _, h := range rl {
+			if h.Response.TLS == nil || len(h.Response.TLS.PeerCertificates) == 0 {
+				continue
+			}
+			left := probe.NewCertificate(h.Response.TLS.PeerCertificates[0]).DaysLeft()
+			if minDays < 0 || left < minDays {
+				minDays = left
+			}
+		}
+
+		if minDays < 0 {
+			return "no certificate", false
+		}
+
+		return strconv.Itoa(minDays), minDays >= days
+	}
+}
+
+// evalAssertions checks all assertions against the hops of a result
+func evalAssertions(al []assertion, resultList []WebRequestResult) []AssertionResult {
+	var results []AssertionResult
+
+	for _, a := range al {
+		ar := AssertionResult{Name: a.name, Expect: a.expect, Actual: "no response"}
+		if len(resultList) > 0 {
+			ar.Actual, ar.Passed = a.eval(resultList)
+		}
+		results = append(results, ar)
+	}
+
+	return results
+}
+
+func assertionsPassed(results []AssertionResult) bool {
+	for _, ar := range results {
+		if !ar.Passed {
+			return false
+		}
+	}
+
+	return true
+}
+
+func chainPrintAssertions(indent, frameChar, titleMsg string, results []AssertionResult) {
+	fmtString := "%s%s   %s\n"
+	fmt.Printf(fmtString, indent, frameChar, at.Bold(titleMsg))
+
+	for _, ar := range results {
+		mark := at.Green("PASS")
+		if !ar.Passed {
+			mark = at.Red("FAIL")
+		}
+		msg := fmt.Sprintf("%s: expected %s, got %s", ar.Name, ar.Expect, ar.Actual)
+		fmt.Printf(fmtString, indent, frameChar, mark+" "+shorten(rootFlags.long, screenWidth-25, msg))
+	}
+	fmt.Printf("%s%s\n", indent, frameChar)
+}
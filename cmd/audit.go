@@ -0,0 +1,131 @@
+/*
+Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	at "github.com/hleinders/AnsiTerm"
+	"github.com/hleinders/htprobe/probe"
+	"github.com/spf13/cobra"
+)
+
+type AuditFlags struct {
+	noFollow  bool
+	showValue bool
+}
+
+var auditFlags AuditFlags
+
+// withAudit adds a security audit of the last hop to every result
+var withAudit bool
+
+var auditShortDesc = "Audits the security headers and cookie flags of a http response"
+
+// auditCmd represents the audit command
+var auditCmd = &cobra.Command{
+	Use:     "audit <URL> [<URL> ...]",
+	Args:    urlArgs,
+	Aliases: []string{"au", "secheaders"},
+	Short:   auditShortDesc,
+	Long: makeHeader(lowerAppName+" audit: "+auditShortDesc) + `With command 'audit', the response of the final hop is checked for
+security headers: HSTS (max-age, includeSubDomains, preload), CSP,
+X-Content-Type-Options, X-Frame-Options or csp frame-ancestors,
+Referrer-Policy, Permissions-Policy, COOP, COEP and CORP. Response
+cookies are checked for the Secure, HttpOnly and SameSite flags.
+Every check is graded PASS, WARN or FAIL, the overall grade ranges
+from A to F.
+Redirects are followed, unless '-n|--no-follow' is given.
+URLs may also be read from a file with '--url-file' or from stdin
+with '-' as URL.
+
+Flags marked with '***' may be used multiple times.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ExecAudit(cmd, args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+	addURLFileFlag(auditCmd)
+	addAssertionFlags(auditCmd)
+
+	// flags
+	auditCmd.Flags().BoolVarP(&auditFlags.noFollow, "no-follow", "n", false, "audit the first response, do not follow redirects")
+	auditCmd.Flags().BoolVarP(&auditFlags.showValue, "show-value", "V", false, "show the header values")
+}
+
+func ExecAudit(cmd *cobra.Command, args []string) {
+	withAudit = true
+	renderer := newRenderer(prettyPrintAudit, bodyNone)
+
+	runURLs(cmd.Context(), args, false, !auditFlags.noFollow, renderer)
+}
+
+func colorGrade(grade probe.AuditGrade) string {
+	switch grade {
+	case probe.GradePass:
+		return at.Green("PASS")
+	case probe.GradeWarn:
+		return at.Yellow("WARN")
+	case probe.GradeFail:
+		return at.Red("FAIL")
+	default:
+		return at.Cyan("INFO")
+	}
+}
+
+func colorOverallGrade(grade string) string {
+	switch grade {
+	case "A", "B":
+		return at.Bold(at.Green(grade))
+	case "C", "D":
+		return at.Bold(at.Yellow(grade))
+	default:
+		return at.Bold(at.Red(grade))
+	}
+}
+
+// function used by audit module
+func chainPrintAudit(indent, frameChar, titleMsg string, report probe.AuditReport) {
+	fmtString := "%s%s   %s\n"
+	fmt.Printf(fmtString, indent, frameChar, at.Bold(titleMsg))
+
+	nameLen := 0
+	for _, c := range report.Checks {
+		nameLen = max(nameLen, len(c.Name))
+	}
+
+	for _, c := range report.Checks {
+		msg := shorten(rootFlags.long, screenWidth-15, fmt.Sprintf("%-*s  %s", nameLen, c.Name, c.Message))
+		fmt.Printf(fmtString, indent, frameChar, colorGrade(c.Grade)+" "+msg)
+		if auditFlags.showValue && c.Value != "" {
+			val := shorten(rootFlags.long, screenWidth-nameLen-22, c.Value)
+			fmt.Printf(fmtString, indent, frameChar, strings.Repeat(" ", nameLen+7)+at.Cyan(val))
+		}
+	}
+
+	fmt.Printf("%s%s\n", indent, frameChar)
+	fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("Grade: %s (%d/100)", colorOverallGrade(report.Grade), report.Score))
+	fmt.Printf("%s%s\n", indent, frameChar)
+}
+
+// prettyPrintAudit prints the title of a chain, the report computed by
+// probeURL is rendered by the text renderer
+func prettyPrintAudit(resultList []WebRequestResult) {
+	last := resultList[len(resultList)-1]
+
+	fmt.Println()
+
+	title := fmt.Sprintf("%s (%s)", last.PrettyPrintFirst(), colorStatus(last.Response.StatusCode))
+	if len(resultList) > 1 {
+		title = fmt.Sprintf("%s  %s %d redirect(s)", title, at.Larrow, len(resultList)-1)
+	}
+	titleLen := len(stripColorCodes(title))
+
+	fmt.Println(title)
+	fmt.Println(strings.Repeat(at.FrameOHLine, titleLen))
+	fmt.Println()
+}
@@ -8,9 +8,9 @@ import (
 	"crypto/x509"
 	"fmt"
 	"strings"
-	"time"
 
 	at "github.com/hleinders/AnsiTerm"
+	"github.com/hleinders/htprobe/probe"
 
 	"github.com/spf13/cobra"
 )
@@ -28,7 +28,7 @@ var certificateShortDesc = "Analyzes and displays server certificates"
 // certificateCmd represents the certificate command
 var certificateCmd = &cobra.Command{
 	Use:     "certificate <URL> [<URL> ...]",
-	Args:    cobra.MinimumNArgs(1),
+	Args:    urlArgs,
 	Aliases: []string{"ct", "crt", "cert"},
 	Short:   certificateShortDesc,
 	Long: makeHeader(lowerAppName+" certificate: "+certificateShortDesc) + `With command 'certificate', the server certificate of URL
@@ -40,6 +40,8 @@ Any server should send a full certificate chain (peer chain).
 A client may prefer its own locally detected and verified chain,
 wich can be displayed with the '-V|--validated-chain' flag.
 This sometimes hides server misconfigurations.
+URLs may also be read from a file with '--url-file' or from stdin
+with '-' as URL.
 
 Flags marked with '***' may be used multiple times.`,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -49,6 +51,8 @@ Flags marked with '***' may be used multiple times.`,
 
 func init() {
 	rootCmd.AddCommand(certificateCmd)
+	addURLFileFlag(certificateCmd)
+	addAssertionFlags(certificateCmd)
 
 	// flags
 	certificateCmd.Flags().BoolVarP(&certificateFlags.follow, "follow", "f", false, "show response cookies for all hops")
@@ -57,83 +61,9 @@ func init() {
 }
 
 func ExecCertificate(cmd *cobra.Command, args []string) {
-	var hops []WebRequestResult
-	var err error
-
-	for _, rawURL := range args {
-		newReq := globalRequestTemplate
-		newReq.url, err = checkURL(rawURL, true)
-		check(err, ErrNoURL)
-
-		// handle the request(s)
-		hops, err = getHops(newReq, certificateFlags.follow)
-		if err != nil {
-			pr.Error("%s", err.Error())
-			continue
-		}
-
-		// display results
-		prettyPrintCertificates(hops)
-	}
-}
-
-type Cert struct {
-	commonName        string
-	rawCName          string
-	subjectANs        []string
-	validFrom         time.Time
-	validUntil        time.Time
-	organization      string
-	organizationUnits string
-	country           string
-	isCA              bool
-	issuerName        string
-	issuerOrg         string
-	issuerOU          string
-	issuerCountry     string
-}
-
-func makeCert(rawCert *x509.Certificate) Cert {
-	var c Cert
-
-	c.rawCName = rawCert.Subject.CommonName
-	c.commonName = strings.ToLower(strings.TrimSpace(c.rawCName))
-	c.subjectANs = rawCert.DNSNames
-	c.validFrom = rawCert.NotBefore
-	c.validUntil = rawCert.NotAfter
-	c.isCA = rawCert.IsCA
-
-	if list := rawCert.Subject.Organization; len(list) > 0 {
-		c.organization = strings.Join(list, ", ")
-	} else {
-		c.organization = "(not available)"
-	}
-
-	if list := rawCert.Subject.OrganizationalUnit; len(list) > 0 {
-		c.organizationUnits = strings.Join(list, ", ")
-	}
-
-	if list := rawCert.Subject.Country; len(list) > 0 {
-		c.country = strings.Join(list, ", ")
-	}
-
-	c.issuerName = rawCert.Issuer.CommonName
-
-	if list := rawCert.Issuer.Organization; len(list) > 0 {
-		c.issuerOrg = strings.Join(list, ", ")
-	} else {
-		c.issuerOrg = "(not available)"
-	}
-
-	if list := rawCert.Issuer.OrganizationalUnit; len(list) > 0 {
-		c.issuerOU = strings.Join(list, ", ")
-	}
-
-	if list := rawCert.Issuer.Country; len(list) > 0 {
-		c.issuerCountry = strings.Join(list, ", ")
-	}
+	renderer := newRenderer(prettyPrintCertificates, bodyNone)
 
-	return c
+	runURLs(cmd.Context(), args, true, certificateFlags.follow, renderer)
 }
 
 func displayCertChain(count int, title, fmtString, indent, frameChar string, chain []*x509.Certificate) {
@@ -150,11 +80,11 @@ func displayCertChain(count int, title, fmtString, indent, frameChar string, cha
 
 }
 
-func displayCertificates(indent, frameChar, mark, titleMsg string, tls *tls.ConnectionState) {
+func displayCertificates(indent, frameChar, mark, titleMsg string, tls *tls.ConnectionState, ca *probe.ClientAuth) {
 	var msgSAN string
 	var found, nameFound bool
 	var displayName, heading string
-	var c0 Cert
+	var c0 probe.Certificate
 
 	fmtString := "%s%s   %s\n"
 	fmt.Printf(fmtString, indent, frameChar, at.Bold(titleMsg))
@@ -167,27 +97,28 @@ func displayCertificates(indent, frameChar, mark, titleMsg string, tls *tls.Conn
 		pr.Debug("Verified Chain: %v\n", tls.VerifiedChains)
 		pr.Debug("Peers: %v\n", peers)
 
-		c0 = makeCert(peers[0])
+		c0 = probe.NewCertificate(peers[0])
 
 		serverName := strings.ToLower(strings.TrimSpace(tls.ServerName))
-		displayName = c0.commonName
+		displayName = c0.CommonName
+		subjectANs := c0.SANs
 
-		if matchGlob(c0.commonName, serverName) {
-			displayName = at.Green(c0.commonName)
+		if matchGlob(c0.CommonName, serverName) {
+			displayName = at.Green(c0.CommonName)
 			nameFound = true
-		} else if found = findGlobInSlice(c0.subjectANs, serverName); found {
-			c0.subjectANs = markGreenInSlice(c0.subjectANs, serverName)
+		} else if found = findGlobInSlice(subjectANs, serverName); found {
+			subjectANs = markGreenInSlice(subjectANs, serverName)
 			nameFound = true
 		}
 
-		if len(c0.subjectANs) > 0 {
-			msgSAN = strings.Join(c0.subjectANs, ", ")
+		if len(subjectANs) > 0 {
+			msgSAN = strings.Join(subjectANs, ", ")
 		} else {
 			msgSAN = "None"
 		}
 
 		if !nameFound {
-			displayName = at.Red(c0.commonName)
+			displayName = at.Red(c0.CommonName)
 			msgSAN = at.Red(msgSAN)
 		}
 
@@ -196,12 +127,12 @@ func displayCertificates(indent, frameChar, mark, titleMsg string, tls *tls.Conn
 		resetColor()
 
 		if certificateFlags.showDetails {
-			fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("  Organization: %s", c0.organization))
-			if c0.organizationUnits != "" {
-				fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("  Unit:         %s", c0.organizationUnits))
+			fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("  Organization: %s", notAvailable(c0.Organization)))
+			if c0.OrganizationUnits != "" {
+				fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("  Unit:         %s", c0.OrganizationUnits))
 			}
-			if c0.country != "" {
-				fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("  Country:      %s", c0.country))
+			if c0.Country != "" {
+				fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("  Country:      %s", c0.Country))
 			}
 		}
 
@@ -212,22 +143,22 @@ func displayCertificates(indent, frameChar, mark, titleMsg string, tls *tls.Conn
 		// print issuer
 		if certificateFlags.showDetails {
 			fmt.Println()
-			fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("  Issuer:       %s", shorten(rootFlags.long, screenWidth-25, c0.issuerName)))
-			fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("  Organization: %s", c0.issuerOrg))
-			if c0.issuerOU != "" {
-				fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("  Unit:         %s", c0.issuerOU))
+			fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("  Issuer:       %s", shorten(rootFlags.long, screenWidth-25, c0.IssuerName)))
+			fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("  Organization: %s", notAvailable(c0.IssuerOrg)))
+			if c0.IssuerOU != "" {
+				fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("  Unit:         %s", c0.IssuerOU))
 			}
-			if c0.issuerCountry != "" {
-				fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("  Country:      %s", c0.issuerCountry))
+			if c0.IssuerCountry != "" {
+				fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("  Country:      %s", c0.IssuerCountry))
 			}
 		}
 
 		// validity
 		if certificateFlags.showDetails {
 			fmt.Println()
-			fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("  Valid from:   %s", c0.validFrom))
+			fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("  Valid from:   %s", c0.ValidFrom))
 		}
-		fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("  Valid until:  %s", colorValidity(c0.validUntil)))
+		fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("  Valid until:  %s", colorValidity(c0.ValidUntil)))
 
 		// print peer chain
 		if certificateFlags.showDetails {
@@ -239,7 +170,7 @@ func displayCertificates(indent, frameChar, mark, titleMsg string, tls *tls.Conn
 			if globalConnSet.trust {
 				peerType = at.Yellow("trust forced")
 			}
-			if c0.isCA {
+			if c0.IsCA {
 				peerType = at.Red("selfsigned")
 			}
 
@@ -263,6 +194,12 @@ func displayCertificates(indent, frameChar, mark, titleMsg string, tls *tls.Conn
 				fmt.Printf(fmtString, indent, frameChar, "  Verified Chain(s): None")
 			}
 		}
+
+		// client certificate (mTLS)
+		if certificateFlags.showDetails {
+			fmt.Println()
+		}
+		displayClientAuth(fmtString, indent, frameChar, ca)
 	} else {
 		fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("%s %s", mark, "(None)"))
 	}
@@ -270,8 +207,51 @@ func displayCertificates(indent, frameChar, mark, titleMsg string, tls *tls.Conn
 	fmt.Printf("%s%s\n", indent, frameChar)
 }
 
+// displayClientAuth shows, whether the server requested a client
+// certificate and which CAs it accepts
+func displayClientAuth(fmtString, indent, frameChar string, ca *probe.ClientAuth) {
+	var msg string
+
+	switch {
+	case ca == nil:
+		msg = "(connection reused)"
+	case !ca.Requested:
+		msg = "not requested"
+	case ca.Sent:
+		msg = at.Green("requested, certificate sent")
+	default:
+		msg = at.Yellow("requested, no certificate sent")
+	}
+	fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("  Client Cert:  %s", msg))
+
+	if ca == nil || !ca.Requested {
+		return
+	}
+
+	if len(ca.AcceptableCAs) == 0 {
+		fmt.Printf(fmtString, indent, frameChar, "  Accepted CAs: any")
+		return
+	}
+
+	for i, dn := range ca.AcceptableCAs {
+		title := ""
+		if i == 0 {
+			title = "Accepted CAs:"
+		}
+		fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("  %-13s %s", title, shorten(rootFlags.long, screenWidth-25, dn)))
+	}
+}
+
+func notAvailable(str string) string {
+	if str == "" {
+		return "(not available)"
+	}
+
+	return str
+}
+
 // function used by redirects module
-func chainPrintCertificates(indent, frameChar, mark, titleMsg string, tls *tls.ConnectionState) {
+func chainPrintCertificates(indent, frameChar, mark, titleMsg string, tls *tls.ConnectionState, ca *probe.ClientAuth) {
 	var msgSAN, msgCaChain string
 	var caChain []string
 
@@ -308,6 +288,15 @@ func chainPrintCertificates(indent, frameChar, mark, titleMsg string, tls *tls.C
 
 		// print chain
 		fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("  CA-Chain:    %s", shorten(rootFlags.long, screenWidth-28, msgCaChain)))
+
+		// client certificate, only if requested
+		if ca != nil && ca.Requested {
+			msg := at.Yellow("requested, no certificate sent")
+			if ca.Sent {
+				msg = at.Green("requested, certificate sent")
+			}
+			fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("  Client Cert: %s", msg))
+		}
 	} else {
 		fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("%s %s", mark, "(None)"))
 	}
@@ -321,13 +310,13 @@ func prettyPrintCertificates(resultList []WebRequestResult) {
 
 	for cnt, h := range resultList {
 
-		title := fmt.Sprintf("%d:  %s (%s)", cnt+1, h.PrettyPrintRedir(cnt), colorStatus(h.response.StatusCode))
+		title := fmt.Sprintf("%d:  %s (%s)", cnt+1, h.PrettyPrintRedir(cnt), colorStatus(h.Response.StatusCode))
 		titleLen := len(stripColorCodes(title))
 
 		fmt.Println(title)
 		fmt.Println(strings.Repeat(at.FrameOHLine, titleLen))
 		fmt.Println()
-		displayCertificates(indentHeader, "", at.BulletChar, "Certificate(s):", h.response.TLS)
+		displayCertificates(indentHeader, "", at.BulletChar, "Certificate(s):", h.Response.TLS, h.ClientAuth)
 		fmt.Println()
 	}
 }
@@ -4,23 +4,19 @@ Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
 package cmd
 
 import (
-	"crypto/tls"
-	"errors"
+	"context"
 	"fmt"
-	"io"
-	"net"
-
 	"net/http"
 	"net/url"
 	"os"
-	"path/filepath"
-	"reflect"
+	"path"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	at "github.com/hleinders/AnsiTerm"
+	"github.com/hleinders/htprobe/probe"
 )
 
 func check(e error, rcode int) {
@@ -45,11 +41,14 @@ func splitFirst(str, sep string) (string, string) {
 	return s[0], strings.Join(s[1:], "")
 }
 
+// matchGlob matches name against a shell pattern (see path.Match), where
+// '*' also matches '/', e.g. in URLs
 func matchGlob(pattern, name string) bool {
 	var matched bool
 
 	if strings.Contains(pattern, "*") {
-		matched, _ = filepath.Match(pattern, name)
+		noSlash := strings.NewReplacer("/", "\x00")
+		matched, _ = path.Match(noSlash.Replace(pattern), noSlash.Replace(name))
 	} else {
 		matched = (pattern == name)
 	}
@@ -101,10 +100,13 @@ func shorten(disable bool, length int, str string) string {
 	return str
 }
 
-func doResolve(host string) string {
-	sip, e := net.LookupHost(host)
-	check(e, ErrResolve)
-	return strings.Join(sip, ", ")
+func doResolve(host string) (string, error) {
+	sip, e := probe.Resolve(context.Background(), host)
+	if e != nil {
+		return "", e
+	}
+
+	return strings.Join(sip, ", "), nil
 }
 
 func getMethodNames() []string {
@@ -177,214 +179,98 @@ func resetColor() {
 	}
 }
 
-// This function parses an string of the form "name: value" to a cookie
-func getCookieFromString(raw string) (http.Cookie, error) {
-	var c http.Cookie
+var envRegex = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces '${NAME}' by the value of the environment variable
+// NAME. Other '$' signs are kept, unset variables are an error.
+func expandEnv(str string) (string, error) {
 	var err error
 
-	r := strings.SplitN(raw, globalCookieSep, 2)
-	if len(r) == 2 {
-		c = http.Cookie{Name: strings.TrimSpace(r[0]), Value: strings.TrimSpace(r[1])}
-	} else {
-		err = fmt.Errorf("could not parse: %s", raw)
-	}
+	res := envRegex.ReplaceAllStringFunc(str, func(m string) string {
+		name := envRegex.FindStringSubmatch(m)[1]
+		val, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable not set: %s", name)
+		}
+		return val
+	})
 
-	return c, err
+	return res, err
 }
 
-func deleteCookieFromList(cookie *http.Cookie, list []*http.Cookie) []*http.Cookie {
-	var result []*http.Cookie
+// expandEnvList expands the environment variables of all entries
+func expandEnvList(list []string) ([]string, error) {
+	var res []string
 
-	for _, c := range list {
-		if c.Name != cookie.Name {
-			result = append(result, c)
+	for _, s := range list {
+		e, err := expandEnv(s)
+		if err != nil {
+			return nil, err
 		}
+		res = append(res, e)
 	}
 
-	return result
+	return res, nil
 }
 
-func findCookieInList(cookie *http.Cookie, list []*http.Cookie) bool {
-	for _, c := range list {
-		if c.Name == cookie.Name {
-			return true
-		}
+// displayHeader masks the credentials of request headers for output,
+// unless '--show-secrets' is given
+func displayHeader(hdr http.Header) http.Header {
+	if rootFlags.showSecrets {
+		return hdr
 	}
 
-	return false
+	return probe.MaskHeader(hdr)
 }
 
-// =================================== HTTP Request Functions ==================================
-func initClient(cs *ConnectionSetup) *http.Client {
-	var rdf func(req *http.Request, via []*http.Request) error
-
-	tr := &http.Transport{}
-
-	if !cs.noHTTP2 {
-		tr.ForceAttemptHTTP2 = true
+// displayCookies masks the values of request cookies for output, unless
+// '--show-secrets' is given
+func displayCookies(cookies []*http.Cookie) []*http.Cookie {
+	if rootFlags.showSecrets {
+		return cookies
 	}
 
-	if cs.trust {
-		tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
-	}
-
-	if cs.proxy != "" {
-		tr.Proxy = func(*http.Request) (*url.URL, error) {
-			return url.Parse(fmt.Sprintf("http://%s", cs.proxy))
-		}
-	}
-
-	if !cs.follow {
-		rdf = func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		}
-	} else {
-		rdf = nil
-	}
-
-	hc := &http.Client{
-		CheckRedirect: rdf,
-		Transport:     tr,
-		Timeout:       cs.timeOut,
-	}
-
-	if cs.acceptCookies {
-		hc.Jar = cs.cookieJar
-	}
-
-	return hc
+	return probe.MaskCookies(cookies)
 }
 
-func doRequest(client *http.Client, wr *WebRequest) (WebRequestResult, error) {
-	var rb io.Reader
-	var result WebRequestResult
-
-	if methodNeedsBody(wr.method) {
-		rb = strings.NewReader(wr.reqBody)
-	}
-
-	req, err := http.NewRequest(wr.method, wr.url.String(), rb)
-	if err != nil {
-		return result, err
-	}
-	if len(wr.agent) != 0 {
-		req.Header.Set("User-Agent", wr.agent)
-	}
-
-	// reqLang?
-	if wr.lang != "" {
-		req.Header.Set("Accept-Language", wr.lang)
-	}
-
-	// Additional header
-	if len(wr.xhdrs) > 0 {
-		for _, s := range wr.xhdrs {
-			n, v := splitFirst(s, globalHeaderSep)
-			req.Header.Set(strings.TrimSpace(n), strings.TrimSpace(v))
-		}
+// displayVariables masks the values of secret session variables for output,
+// unless '--show-secrets' is given
+func displayVariables(vars map[string]string, secret map[string]bool) map[string]string {
+	if rootFlags.showSecrets {
+		return vars
 	}
 
-	// Auth?
-	if wr.authUser != "" && wr.authPass != "" {
-		req.SetBasicAuth(wr.authUser, wr.authPass)
-	}
-
-	if len(wr.cookieLst) > 0 {
-		for _, c := range wr.cookieLst {
-			req.AddCookie(c)
-		}
-	}
-
-	pr.Debug("Client:\n%+v\n", client)
-	pr.Debug("Request:\n%+v\n", req)
-	pr.Debug("Cookies:\n%+v\n", client.Jar)
-
-	// handle request
-	resp, errReq := client.Do(req)
-	if errReq == nil {
-		result.request = *req
-		result.response = *resp
-		if client.Jar != nil {
-			result.cookieLst = client.Jar.Cookies(resp.Request.URL)
-		}
-	} else {
-		pr.Debug("Error is: %s\n", reflect.TypeOf(errReq))
-		pr.Debug("Error details: %+v\n", errors.Unwrap(errReq))
-		te := errors.Unwrap(errReq)
-		pr.Debug("Unwrapped error is: %s\n", reflect.TypeOf(te))
-		pr.Debug("Unwrapped error details: %+v\n", errors.Unwrap(te))
-	}
-
-	pr.Debug("Response:\n%+v\n", resp)
-
-	// check if cookie went to jar:
-	for _, c := range result.cookieLst {
-		if findCookieInList(c, wr.cookieLst) {
-			wr.cookieLst = deleteCookieFromList(c, wr.cookieLst)
-		}
-	}
-
-	return result, errReq
+	return probe.MaskValues(vars, secret)
 }
 
-func follow(wr *WebRequest, cs *ConnectionSetup) ([]WebRequestResult, error) {
-	var resultList []WebRequestResult
-
-	// init client
-	hc := initClient(cs)
-
-	// initial request
-	result, err := doRequest(hc, wr)
-	check(err, ErrRequest)
-
-	// add to list:
-	resultList = append(resultList, result)
-
-	cnt := 0
-	// repeat until no further redirect happens:
-	for result.response.StatusCode >= 301 && result.response.StatusCode <= 399 {
-		// detect next hop:
-		rdURL, e := result.response.Location()
-		check(e, ErrResponse)
-
-		// update the request
-		wr.url = *rdURL
-		wr.method = result.response.Request.Method
-
-		// next hop:
-		result, err = doRequest(hc, wr)
-		check(err, ErrRequest)
-
-		// limit reached?
-		cnt++
-		if cnt >= MaxRedirects {
-			result.response.StatusCode = 999
-			result.response.Status = "999 Too many redirects"
-		}
+// ensureCookieJar turns on accepting response cookies and creates the
+// global cookie jar, if not done yet
+func ensureCookieJar() {
+	var err error
 
-		// add to list:
-		resultList = append(resultList, result)
+	globalConnSet.acceptCookies = true
+	if globalConnSet.cookieJar == nil {
+		globalConnSet.cookieJar, err = probe.NewJar()
+		check(err, ErrCookieJar)
 	}
-
-	return resultList, err
 }
 
-func noFollow(wr *WebRequest, cs *ConnectionSetup) ([]WebRequestResult, error) {
-	var resultList []WebRequestResult
-
-	// init client
-	hc := initClient(cs)
-
-	// initial and only request
-	result, err := doRequest(hc, wr)
-	check(err, ErrRequest)
+// This function parses an string of the form "name: value" to a cookie
+func getCookieFromString(raw string) (http.Cookie, error) {
+	var c http.Cookie
+	var err error
 
-	// add to list:
-	resultList = append(resultList, result)
+	r := strings.SplitN(raw, globalCookieSep, 2)
+	if len(r) == 2 {
+		c = http.Cookie{Name: strings.TrimSpace(r[0]), Value: strings.TrimSpace(r[1])}
+	} else {
+		err = fmt.Errorf("could not parse: %s", raw)
+	}
 
-	return resultList, err
+	return c, err
 }
 
+// =================================== HTTP Request Functions ==================================
 func checkURL(rawURL string, useSSL bool) (url.URL, error) {
 	var u *url.URL
 	var e error
@@ -410,15 +296,24 @@ func checkURL(rawURL string, useSSL bool) (url.URL, error) {
 	return *u, e
 }
 
-func getHops(req WebRequest, doFollow bool) ([]WebRequestResult, error) {
+func getHops(ctx context.Context, req WebRequest, doFollow bool) ([]WebRequestResult, error) {
+	return getHopsWith(ctx, globalConnSet, req, doFollow)
+}
+
+// getHopsWith does the request(s) with another connection setup
+func getHopsWith(ctx context.Context, cs ConnectionSetup, req WebRequest, doFollow bool) ([]WebRequestResult, error) {
 	var hops []WebRequestResult
-	var err error
 
 	// handle the request(s)
-	if doFollow {
-		hops, err = follow(&req, &globalConnSet)
-	} else {
-		hops, err = noFollow(&req, &globalConnSet)
+	pc := probe.New(cs.options())
+	chain, err := pc.Probe(ctx, req.probeRequest(doFollow))
+
+	for _, h := range chain.Hops {
+		hops = append(hops, WebRequestResult{Hop: h})
+	}
+
+	for _, i := range chain.Loop {
+		hops[i].loopHop = i + 1
 	}
 
 	return hops, err
@@ -0,0 +1,29 @@
+/*
+Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
+*/
+package cmd
+
+import "testing"
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"www.example.com", "www.example.com", true},
+		{"*.example.com", "www.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"https://example.com/*", "https://example.com/a/b?x=1", true},
+		{"https://*/login", "https://sso.example.com/login", true},
+		{"https://example.com/*/end", "https://example.com/a/b/end", true},
+		{"https://example.com/*", "http://example.com/a", false},
+		{"https://example.com/a", "https://example.com/a/", false},
+		{"*[", "x[", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
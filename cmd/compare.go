@@ -0,0 +1,437 @@
+/*
+Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	at "github.com/hleinders/AnsiTerm"
+	"github.com/hleinders/htprobe/probe"
+	"github.com/spf13/cobra"
+)
+
+type CompareFlags struct {
+	resolveA, resolveB []string
+	proxyA, proxyB     string
+	ignoreHeaders      []string
+}
+
+var compareFlags CompareFlags
+
+var compareShortDesc = "Compares the redirect chains of two URLs or environments"
+
+// compareCmd represents the compare command
+var compareCmd = &cobra.Command{
+	Use:     "compare <URL A> [<URL B>]",
+	Args:    cobra.RangeArgs(1, 2),
+	Aliases: []string{"cmp", "diff"},
+	Short:   compareShortDesc,
+	Long: makeHeader(lowerAppName+" compare: "+compareShortDesc) + `With command 'compare', the redirect chains of two URLs (e.g. staging
+and production) are followed and compared hop by hop: status, path,
+response headers and the attributes of response cookies. Hosts are
+compared relative to the start of each chain: a hop either stays on the
+start host or goes to another host.
+With a single URL, the chain is requested twice with different
+connection settings: '--resolve-a|b' connects to another address (like
+curl's '--resolve host:port:address'), '--proxy-a|b' uses another proxy.
+Both can't be combined, as a proxy resolves the host itself.
+Headers, that differ on every request (e.g. 'Date'), are ignored.
+If the chains diverge, the return value is ` + strconv.Itoa(ErrDiverged) + `, if a chain fails,
+the return value of its error.
+
+Flags marked with '***' may be used multiple times.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ExecCompare(cmd, args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(compareCmd)
+
+	// Parameter
+	compareCmd.Flags().StringArrayVar(&compareFlags.resolveA, "resolve-a", nil, "connect chain A to address (fmt: `host:port:address`); ***")
+	compareCmd.Flags().StringArrayVar(&compareFlags.resolveB, "resolve-b", nil, "connect chain B to address (fmt: `host:port:address`); ***")
+	compareCmd.Flags().StringVar(&compareFlags.proxyA, "proxy-a", "", "use `host(:port)` as proxy for chain A")
+	compareCmd.Flags().StringVar(&compareFlags.proxyB, "proxy-b", "", "use `host(:port)` as proxy for chain B")
+	compareCmd.Flags().StringSliceVar(&compareFlags.ignoreHeaders, "ignore-header", []string{"Date", "Age", "Expires", "Last-Modified", "Etag", "Content-Length", "Location", "Set-Cookie"}, "do not compare response header `FOOBAR`; ***")
+}
+
+// CompareDiff is a difference between the chains. Hop is 0 for the whole
+// chain, A or B is empty, if missing on that side.
+type CompareDiff struct {
+	Hop   int    `json:"hop"`
+	Field string `json:"field"`
+	A     string `json:"a"`
+	B     string `json:"b"`
+}
+
+// CompareRecord is the result of a comparison
+type CompareRecord struct {
+	A         ChainRecord   `json:"a"`
+	B         ChainRecord   `json:"b"`
+	Identical bool          `json:"identical"`
+	Diffs     []CompareDiff `json:"diffs"`
+}
+
+// compareSide is one of the two compared chains
+type compareSide struct {
+	name   string
+	rawURL string
+	cs     ConnectionSetup
+	res    urlResult
+}
+
+func ExecCompare(cmd *cobra.Command, args []string) {
+	urlA, urlB := args[0], args[0]
+	if len(args) > 1 {
+		urlB = args[1]
+	} else if len(compareFlags.resolveA)+len(compareFlags.resolveB) == 0 && compareFlags.proxyA == compareFlags.proxyB {
+		check(errors.New("a single URL needs different '--resolve-a|b' or '--proxy-a|b' settings"), ErrNoArg)
+	}
+
+	sideA, err := newCompareSide("A", urlA, compareFlags.proxyA, compareFlags.resolveA)
+	check(err, ErrGetFlag)
+	sideB, err := newCompareSide("B", urlB, compareFlags.proxyB, compareFlags.resolveB)
+	check(err, ErrGetFlag)
+
+	sideA.run(cmd.Context())
+	sideB.run(cmd.Context())
+
+	rec := CompareRecord{
+		A:     makeChainRecord(sideA.res, bodyNone),
+		B:     makeChainRecord(sideB.res, bodyNone),
+		Diffs: compareChains(sideA.res, sideB.res),
+	}
+	rec.Identical = len(rec.Diffs) == 0
+
+	if isTextOutput() {
+		prettyPrintCompare(sideA, sideB, rec)
+	} else {
+		writeJSON(os.Stdout, rec, rootFlags.output == OutputJSON)
+	}
+
+	switch {
+	case !sideA.res.ok():
+		globalExitCode = errorExitCode(sideA.res.err)
+	case !sideB.res.ok():
+		globalExitCode = errorExitCode(sideB.res.err)
+	case !rec.Identical:
+		globalExitCode = ErrDiverged
+	}
+}
+
+// newCompareSide derives the connection setup of a side from the global
+// one. Cookies are kept per side, starting with the loaded cookie jar.
+func newCompareSide(name, rawURL, proxy string, resolve []string) (compareSide, error) {
+	var err error
+
+	side := compareSide{name: name, rawURL: rawURL, cs: globalConnSet}
+
+	if proxy != "" {
+		side.cs.proxy = proxy
+	}
+
+	side.cs.resolve, err = parseResolve(resolve)
+	if err != nil {
+		return side, err
+	}
+	// the dialer connects to the proxy, which resolves the host itself
+	if side.cs.resolve != nil && side.cs.proxy != "" {
+		return side, fmt.Errorf("chain %s: '--resolve-%s' does not work with a proxy", name, strings.ToLower(name))
+	}
+
+	if side.cs.acceptCookies {
+		jar, err := probe.NewJar()
+		if err != nil {
+			return side, err
+		}
+		if globalConnSet.cookieJar != nil {
+			jar.Add(globalConnSet.cookieJar.Entries())
+		}
+		side.cs.cookieJar = jar
+	}
+
+	return side, nil
+}
+
+// parseResolve converts entries like curl's '--resolve host:port:address'
+func parseResolve(list []string) (map[string]string, error) {
+	if len(list) == 0 {
+		return nil, nil
+	}
+
+	resolve := map[string]string{}
+	for _, entry := range list {
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("invalid resolve entry (fmt: host:port:address): %s", entry)
+		}
+		if _, err := strconv.ParseUint(parts[1], 10, 16); err != nil {
+			return nil, fmt.Errorf("invalid port in resolve entry: %s", entry)
+		}
+
+		addr := strings.TrimSuffix(strings.TrimPrefix(parts[2], "["), "]")
+		resolve[net.JoinHostPort(parts[0], parts[1])] = addr
+	}
+
+	return resolve, nil
+}
+
+func (s *compareSide) run(ctx context.Context) {
+	s.res = urlResult{rawURL: s.rawURL}
+
+	req := globalRequestTemplate
+	u, err := checkURL(s.rawURL, false)
+	if err != nil {
+		s.res.err = &probe.Error{Kind: probe.KindURL, URL: s.rawURL, Err: err}
+		return
+	}
+	req.url = u
+
+	s.res.hops, s.res.err = getHopsWith(ctx, s.cs, req, true)
+}
+
+// description returns the URL and the connection settings of the side
+func (s compareSide) description() string {
+	var settings []string
+
+	if s.cs.proxy != "" {
+		settings = append(settings, "proxy "+s.cs.proxy)
+	}
+	for _, hp := range sortedMapKeys(s.cs.resolve) {
+		settings = append(settings, fmt.Sprintf("resolve %s to %s", hp, s.cs.resolve[hp]))
+	}
+
+	if len(settings) == 0 {
+		return s.rawURL
+	}
+
+	return fmt.Sprintf("%s  (%s)", s.rawURL, strings.Join(settings, ", "))
+}
+
+// compareChains lists the differences of two chains. Hosts are compared
+// relative to the start host of each chain.
+func compareChains(a, b urlResult) []CompareDiff {
+	diffs := []CompareDiff{}
+	add := func(hop int, field, va, vb string) {
+		if va != vb {
+			diffs = append(diffs, CompareDiff{Hop: hop, Field: field, A: va, B: vb})
+		}
+	}
+
+	add(0, "error", errorKindText(a.err), errorKindText(b.err))
+
+	for i := 0; i < max(len(a.hops), len(b.hops)); i++ {
+		if i >= len(a.hops) || i >= len(b.hops) {
+			add(i+1, "hop", hopSummary(a.hops, i), hopSummary(b.hops, i))
+			continue
+		}
+
+		ha, hb := a.hops[i], b.hops[i]
+		add(i+1, "method", ha.Request.Method, hb.Request.Method)
+		add(i+1, "status", strconv.Itoa(ha.Response.StatusCode), strconv.Itoa(hb.Response.StatusCode))
+		add(i+1, "host", hopHost(a.hops, i), hopHost(b.hops, i))
+		add(i+1, "path", hopPath(ha), hopPath(hb))
+
+		for _, d := range diffHeaders(ha.Response.Header, hb.Response.Header, compareFlags.ignoreHeaders) {
+			add(i+1, "header "+d.Name, d.Recorded, d.Live)
+		}
+
+		ca, cb := setCookieAttributes(ha), setCookieAttributes(hb)
+		names := map[string]string{}
+		for n := range ca {
+			names[n] = ""
+		}
+		for n := range cb {
+			names[n] = ""
+		}
+		for _, n := range sortedMapKeys(names) {
+			add(i+1, "cookie "+n, ca[n], cb[n])
+		}
+	}
+
+	return diffs
+}
+
+func errorKindText(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	return probe.KindOf(err).String()
+}
+
+// hopPath returns path and query of the hop's URL
+func hopPath(h WebRequestResult) string {
+	return h.Request.URL.RequestURI()
+}
+
+// startHost marks a hop to scheme and host of the chain's first hop
+const startHost = "start host"
+
+// hopHost returns scheme and host of hop i, or startHost
+func hopHost(hops []WebRequestResult, i int) string {
+	start, u := hops[0].Request.URL, hops[i].Request.URL
+	if u.Scheme == start.Scheme && strings.EqualFold(u.Host, start.Host) {
+		return startHost
+	}
+
+	return u.Scheme + "://" + u.Host
+}
+
+// hopTarget returns the path of hop i, with scheme and host, if the hop
+// leaves the start host
+func hopTarget(hops []WebRequestResult, i int) string {
+	if host := hopHost(hops, i); host != startHost {
+		return host + hopPath(hops[i])
+	}
+
+	return hopPath(hops[i])
+}
+
+// hopSummary returns status and target of hop i, if it exists
+func hopSummary(hops []WebRequestResult, i int) string {
+	if i >= len(hops) {
+		return ""
+	}
+
+	return fmt.Sprintf("%d %s", hops[i].Response.StatusCode, hopTarget(hops, i))
+}
+
+// setCookieAttributes maps the names of the response cookies to their
+// attributes; values, domains and expiry dates differ anyway
+func setCookieAttributes(h WebRequestResult) map[string]string {
+	attrs := map[string]string{}
+
+	for _, c := range h.SetCookies() {
+		list := []string{"set"}
+		if c.Path != "" {
+			list = append(list, "path="+c.Path)
+		}
+		if c.Secure {
+			list = append(list, "secure")
+		}
+		if c.HttpOnly {
+			list = append(list, "httponly")
+		}
+		if c.SameSite != "" {
+			list = append(list, "samesite="+c.SameSite)
+		}
+		if c.Partitioned {
+			list = append(list, "partitioned")
+		}
+		switch {
+		case c.Expired():
+			list = append(list, "expired")
+		case c.Session():
+			list = append(list, "session")
+		}
+		attrs[c.Name] = strings.Join(list, "; ")
+	}
+
+	return attrs
+}
+
+func prettyPrintCompare(a, b compareSide, rec CompareRecord) {
+	fmtString := "%s%s   %s\n"
+
+	fmt.Println()
+	title := at.Bold("Compare:")
+	fmt.Println(title)
+	fmt.Println(strings.Repeat(at.FrameOHLine, len(stripColorCodes(title))))
+	fmt.Println()
+	fmt.Printf(fmtString, indentHeader, "", fmt.Sprintf("%s A: %s", at.BulletChar, a.description()))
+	fmt.Printf(fmtString, indentHeader, "", fmt.Sprintf("%s B: %s", at.BulletChar, b.description()))
+	fmt.Println()
+
+	// hops side by side, differing hops are marked
+	width := max(20, (screenWidth-16)/2)
+	diffHops := map[int]bool{}
+	for _, d := range rec.Diffs {
+		diffHops[d.Hop] = true
+	}
+
+	mark := at.Red("≠")
+	if rootFlags.ascii || rootFlags.noFancy {
+		mark = at.Red("!")
+	}
+
+	fmt.Printf("%s%-5s %s   %s\n", indentHeader, "Hop", padRight(at.Bold("A"), width), at.Bold("B"))
+	for i := 0; i < max(len(a.res.hops), len(b.res.hops)); i++ {
+		m := " "
+		if diffHops[i+1] {
+			m = mark
+		}
+		fmt.Printf("%s%-5d %s %s %s\n", indentHeader, i+1, padRight(compareCell(a.res.hops, i, width), width), m, compareCell(b.res.hops, i, width))
+	}
+	fmt.Println()
+
+	for _, s := range []compareSide{a, b} {
+		if !s.res.ok() {
+			pr.Errorln("%s: %s: %s", s.name, s.rawURL, s.res.err.Error())
+		}
+	}
+	if !a.res.ok() || !b.res.ok() {
+		fmt.Println()
+	}
+
+	// details
+	if len(rec.Diffs) > 0 {
+		fmt.Printf(fmtString, indentHeader, "", fmt.Sprintf("%s %s", at.BulletChar, "Differences:"))
+	}
+	for _, d := range rec.Diffs {
+		var where string
+		switch {
+		case d.Hop == 0:
+			where = d.Field
+		case d.Field == "hop":
+			where = fmt.Sprintf("hop %d", d.Hop)
+		default:
+			where = fmt.Sprintf("hop %d %s", d.Hop, d.Field)
+		}
+
+		var line string
+		switch {
+		case d.A == "":
+			line = at.Green(fmt.Sprintf("+ %s: %s (only B)", where, d.B))
+		case d.B == "":
+			line = at.Red(fmt.Sprintf("- %s: %s (only A)", where, d.A))
+		default:
+			line = at.Yellow(fmt.Sprintf("~ %s: %s %s %s", where, d.A, rarrow, d.B))
+		}
+		fmt.Printf(fmtString, indentHeader, "", "    "+shorten(rootFlags.long, screenWidth-15, line))
+	}
+
+	result := at.Green("identical")
+	if !rec.Identical {
+		result = at.Yellow("different")
+	}
+	fmt.Println()
+	fmt.Printf(fmtString, indentHeader, "", fmt.Sprintf("%s %-8s %s", at.BulletChar, "Result:", result))
+	fmt.Println()
+}
+
+// compareCell shows status and target of hop i
+func compareCell(hops []WebRequestResult, i, width int) string {
+	if i >= len(hops) {
+		return "-"
+	}
+
+	return fmt.Sprintf("(%s) %s", colorStatus(hops[i].Response.StatusCode), shorten(rootFlags.long, width-6, hopTarget(hops, i)))
+}
+
+// padRight fills a colored string with spaces up to width visible chars
+func padRight(str string, width int) string {
+	if n := len([]rune(stripColorCodes(str))); n < width {
+		return str + strings.Repeat(" ", width-n)
+	}
+
+	return str
+}
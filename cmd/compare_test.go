@@ -0,0 +1,120 @@
+/*
+Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
+*/
+package cmd
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/hleinders/htprobe/probe"
+)
+
+func TestParseResolve(t *testing.T) {
+	tests := []struct {
+		name string
+		list []string
+		want map[string]string
+		err  bool
+	}{
+		{"empty", nil, nil, false},
+		{"ipv4", []string{"www.example.com:443:10.0.0.11"}, map[string]string{"www.example.com:443": "10.0.0.11"}, false},
+		{"ipv6", []string{"www.example.com:443:[2001:db8::1]"}, map[string]string{"www.example.com:443": "2001:db8::1"}, false},
+		{"ipv6 unbracketed", []string{"www.example.com:80:2001:db8::1"}, map[string]string{"www.example.com:80": "2001:db8::1"}, false},
+		{"several", []string{"a.example.com:443:10.0.0.1", "b.example.com:8443:10.0.0.2"}, map[string]string{"a.example.com:443": "10.0.0.1", "b.example.com:8443": "10.0.0.2"}, false},
+		{"missing address", []string{"www.example.com:443"}, nil, true},
+		{"empty address", []string{"www.example.com:443:"}, nil, true},
+		{"missing host", []string{":443:10.0.0.11"}, nil, true},
+		{"invalid port", []string{"www.example.com:https:10.0.0.11"}, nil, true},
+		{"port out of range", []string{"www.example.com:65536:10.0.0.11"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseResolve(tt.list)
+			if (err != nil) != tt.err {
+				t.Fatalf("parseResolve() error = %v, want error %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseResolve() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// testChain returns a result with a hop per "status url" pair
+func testChain(hops ...any) urlResult {
+	var res urlResult
+
+	for i := 0; i < len(hops); i += 2 {
+		u, _ := url.Parse(hops[i+1].(string))
+		req := &http.Request{Method: http.MethodGet, URL: u}
+		res.hops = append(res.hops, WebRequestResult{Hop: probe.Hop{
+			Request:  req,
+			Response: &http.Response{StatusCode: hops[i].(int), Header: http.Header{}, Request: req},
+		}})
+	}
+
+	return res
+}
+
+func TestCompareChains(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b urlResult
+		want []CompareDiff
+	}{
+		{
+			name: "identical on other hosts",
+			a:    testChain(301, "https://staging.example.com/shop", 200, "https://staging.example.com/shop/"),
+			b:    testChain(301, "https://www.example.com/shop", 200, "https://www.example.com/shop/"),
+			want: []CompareDiff{},
+		},
+		{
+			name: "same foreign host",
+			a:    testChain(302, "https://staging.example.com/", 200, "https://sso.example.com/login"),
+			b:    testChain(302, "https://www.example.com/", 200, "https://sso.example.com/login"),
+			want: []CompareDiff{},
+		},
+		{
+			name: "leaves start host",
+			a:    testChain(302, "https://staging.example.com/", 200, "https://staging.example.com/login"),
+			b:    testChain(302, "https://www.example.com/", 200, "https://sso.example.com/login"),
+			want: []CompareDiff{{Hop: 2, Field: "host", A: startHost, B: "https://sso.example.com"}},
+		},
+		{
+			name: "scheme",
+			a:    testChain(301, "http://www.example.com/", 200, "https://www.example.com/"),
+			b:    testChain(301, "http://www.example.com/", 200, "http://www.example.com/"),
+			want: []CompareDiff{{Hop: 2, Field: "host", A: "https://www.example.com", B: startHost}},
+		},
+		{
+			name: "status and path",
+			a:    testChain(302, "https://a.example.com/", 200, "https://a.example.com/x"),
+			b:    testChain(301, "https://b.example.com/", 200, "https://b.example.com/y"),
+			want: []CompareDiff{
+				{Hop: 1, Field: "status", A: "302", B: "301"},
+				{Hop: 2, Field: "path", A: "/x", B: "/y"},
+			},
+		},
+		{
+			name: "missing hop",
+			a:    testChain(302, "https://a.example.com/", 200, "https://sso.example.com/login"),
+			b:    testChain(200, "https://b.example.com/"),
+			want: []CompareDiff{
+				{Hop: 1, Field: "status", A: "302", B: "200"},
+				{Hop: 2, Field: "hop", A: "200 https://sso.example.com/login", B: ""},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compareChains(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("compareChains() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
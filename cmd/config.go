@@ -0,0 +1,193 @@
+/*
+Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultProfile is used, if no profile is selected with '--profile'
+const DefaultProfile = "default"
+
+var (
+	configFileName string
+	profileName    string
+)
+
+// A Profile maps the long names of global flags to their values. Lists
+// are used for flags, that may be given multiple times.
+type Profile map[string]any
+
+// ConfigFile is the content of the config file
+type ConfigFile struct {
+	Profiles map[string]Profile `yaml:"profiles"`
+}
+
+// defaultConfigFile returns the path of config.yaml in the user's config
+// directory: ~/.config/htprobe/config.yaml (or below $XDG_CONFIG_HOME), on
+// Windows below %AppData%
+func defaultConfigFile() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" && runtime.GOOS != "windows" {
+		if home, err := os.UserHomeDir(); err == nil {
+			dir = filepath.Join(home, ".config")
+		}
+	}
+	if dir == "" {
+		var err error
+		if dir, err = os.UserConfigDir(); err != nil {
+			return ""
+		}
+	}
+
+	return filepath.Join(dir, lowerAppName, "config.yaml")
+}
+
+// readConfigFile reads fname. A missing default config file is no error.
+func readConfigFile(fname string, isDefault bool) (ConfigFile, error) {
+	var cfg ConfigFile
+
+	f, err := os.Open(fname)
+	if isDefault && errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return cfg, fmt.Errorf("%s: %w", fname, err)
+	}
+
+	return cfg, nil
+}
+
+// applyProfile sets all global flags of the selected profile, that were
+// not given on the command line. Without '--profile', the profile
+// 'default' is used, if it exists.
+func applyProfile(flags *pflag.FlagSet) error {
+	fname, isDefault := configFileName, false
+	if fname == "" {
+		fname, isDefault = defaultConfigFile(), true
+	}
+	if fname == "" {
+		return nil
+	}
+
+	cfg, err := readConfigFile(fname, isDefault)
+	if err != nil {
+		return err
+	}
+
+	name := profileName
+	if name == "" {
+		name = DefaultProfile
+	}
+
+	profile, ok := cfg.Profiles[name]
+	if !ok {
+		if profileName == "" {
+			return nil
+		}
+		return fmt.Errorf("%s: unknown profile: %s", fname, profileName)
+	}
+
+	// sorted for reproducible errors
+	keys := make([]string, 0, len(profile))
+	for k := range profile {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if f := flags.Lookup(k); f == nil || k == "config" || k == "profile" {
+			return fmt.Errorf("%s: profile %s: unknown flag: %s", fname, name, k)
+		}
+	}
+
+	// the command line wins
+	skip := overriddenFlags(flags)
+
+	for _, k := range keys {
+		if skip[k] {
+			continue
+		}
+
+		values, ok := profile[k].([]any)
+		if !ok {
+			values = []any{profile[k]}
+		}
+		for _, v := range values {
+			if err := flags.Set(k, fmt.Sprint(v)); err != nil {
+				return fmt.Errorf("%s: profile %s: %s: %w", fname, name, k, err)
+			}
+		}
+	}
+
+	activeProfile = name
+	activeConfigFile = fname
+
+	return nil
+}
+
+// overriddenFlags returns the flags given on the command line together with
+// the flags excluded by them: a flag mutually exclusive with a given one
+// and the flags required together with an excluded one, e.g. '--bearer'
+// of a profile is not used with '--user' on the command line
+func overriddenFlags(flags *pflag.FlagSet) map[string]bool {
+	skip := map[string]bool{}
+
+	// groups returns the groups of table containing name
+	groups := func(name string, table [][]string) [][]string {
+		var gl [][]string
+		for _, g := range table {
+			if slices.Contains(g, name) {
+				gl = append(gl, g)
+			}
+		}
+		return gl
+	}
+
+	var excluded []string
+	flags.VisitAll(func(f *pflag.Flag) {
+		if !f.Changed {
+			return
+		}
+		skip[f.Name] = true
+		for _, g := range groups(f.Name, exclusiveFlags) {
+			excluded = append(excluded, g...)
+		}
+	})
+
+	// groups required together are skipped as a whole
+	for len(excluded) > 0 {
+		name := excluded[0]
+		excluded = excluded[1:]
+		if skip[name] {
+			continue
+		}
+		skip[name] = true
+		for _, g := range groups(name, requiredTogetherFlags) {
+			excluded = append(excluded, g...)
+		}
+	}
+
+	return skip
+}
+
+// name and file of the applied profile, for debugging
+var activeProfile, activeConfigFile string
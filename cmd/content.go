@@ -5,7 +5,6 @@ package cmd
 
 import (
 	"fmt"
-	"io"
 	"os"
 	"strings"
 
@@ -25,12 +24,14 @@ var contentShortDesc = "Makes a http request and displays the content of the res
 // contentCmd represents the content command
 var contentCmd = &cobra.Command{
 	Use:     "content <URL> [<URL> ...]",
-	Args:    cobra.MinimumNArgs(1),
+	Args:    urlArgs,
 	Aliases: []string{"cnt", "cont"},
 	Short:   contentShortDesc,
 	Long: makeHeader(lowerAppName+" content: "+contentShortDesc) + `With command 'content', the full response body
 	is shown. You may pass the '-f|--follow' flag to follow redirects.
 	In this case, the content of any hop is displayed.
+	URLs may also be read from a file with '--url-file' or from stdin
+	with '-' as URL.
 
 	Flags marked with '***' may be used multiple times.`,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -40,6 +41,9 @@ var contentCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(contentCmd)
+	addURLFileFlag(contentCmd)
+	addAssertionFlags(contentCmd)
+	addHARFlags(contentCmd)
 
 	// flags
 	contentCmd.Flags().BoolVarP(&contentFlags.follow, "follow", "f", false, "show content for all hops")
@@ -49,24 +53,10 @@ func init() {
 }
 
 func ExecContent(cmd *cobra.Command, args []string) {
-	var hops []WebRequestResult
-	var err error
-
-	for _, rawURL := range args {
-		newReq := globalRequestTemplate
-		newReq.url, err = checkURL(rawURL, false)
-		check(err, ErrNoURL)
-
-		// handle the request(s)
-		hops, err = getHops(newReq, contentFlags.follow)
-		if err != nil {
-			pr.Error("%s", err.Error())
-			continue
-		}
+	renderer := newRenderer(prettyPrintContent, bodyAll)
 
-		// display results
-		prettyPrintContent(hops)
-	}
+	results := runURLs(cmd.Context(), args, false, contentFlags.follow, renderer)
+	writeHAR(results)
 }
 
 func prettyPrintContent(resultList []WebRequestResult) {
@@ -90,21 +80,16 @@ func prettyPrintContent(resultList []WebRequestResult) {
 
 	for cnt, h := range resultList {
 
-		title := fmt.Sprintf("%d:  %s (%s)", cnt+1, h.PrettyPrintRedir(cnt), colorStatus(h.response.StatusCode))
+		title := fmt.Sprintf("%d:  %s (%s)", cnt+1, h.PrettyPrintRedir(cnt), colorStatus(h.Response.StatusCode))
 		titleLen := len(stripColorCodes(title))
 
 		fmt.Fprintln(out, title)
 		fmt.Fprintln(out, strings.Repeat(at.FrameOHLine, titleLen))
 		fmt.Fprintln(out)
 
-		body, err := io.ReadAll(h.response.Body)
-		if err != nil {
-			pr.Errorln("%s", err)
-		} else {
-			fmt.Fprintln(out, at.Bold("Content:"))
-			fmt.Fprintln(out, at.Bold(strings.Repeat(at.FrameOHLine, 8)))
-			fmt.Fprintf(out, "\n%+v\n", string(body))
-		}
+		fmt.Fprintln(out, at.Bold("Content:"))
+		fmt.Fprintln(out, at.Bold(strings.Repeat(at.FrameOHLine, 8)))
+		fmt.Fprintf(out, "\n%+v\n", string(h.Body))
 
 		fmt.Fprintln(out)
 	}
@@ -6,10 +6,11 @@ package cmd
 import (
 	"fmt"
 	"net/http"
-	"os"
 	"strings"
+	"time"
 
 	at "github.com/hleinders/AnsiTerm"
+	"github.com/hleinders/htprobe/probe"
 	"github.com/spf13/cobra"
 )
 
@@ -26,12 +27,14 @@ var cookieShortDesc = "Shows the request and response cookies of a http request"
 // cookiesCmd represents the cookies command
 var cookiesCmd = &cobra.Command{
 	Use:     "cookies <URL> [<URL> ...]",
-	Args:    cobra.MinimumNArgs(1),
+	Args:    urlArgs,
 	Aliases: []string{"ck", "cookie"},
 	Short:   cookieShortDesc,
 	Long: makeHeader(lowerAppName+" cookies: "+cookieShortDesc) + `With command 'cookies', all request and response cookies
 are shown. You may pass the '-f|--follow' flag to follow redirects.
 In this case, the cookies are displayed in any hop.
+URLs may also be read from a file with '--url-file' or from stdin
+with '-' as URL.
 
 Flags marked with '***' may be used multiple times.`,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -41,45 +44,34 @@ Flags marked with '***' may be used multiple times.`,
 
 func init() {
 	rootCmd.AddCommand(cookiesCmd)
+	addURLFileFlag(cookiesCmd)
+	addAssertionFlags(cookiesCmd)
 
 	// flags
 	cookiesCmd.Flags().BoolVarP(&cookieFlags.follow, "follow", "f", false, "show cookies for all hops")
 
 	// Parameter
 	cookiesCmd.Flags().StringSliceVarP(&cookieFlags.displaySingleCookie, "show-cookie", "D", nil, "show only cookie `FOOBAR`; ***")
-	cookiesCmd.Flags().StringVarP(&cookieFlags.SaveCookiesFName, "save-cookies", "S", "", "save cookie(s) to `file`")
+	cookiesCmd.Flags().StringVarP(&cookieFlags.SaveCookiesFName, "save-cookies", "S", "", "save response cookie(s) to `file` (Netscape cookies.txt, JSON if *.json)")
 }
 
 func ExecCookies(cmd *cobra.Command, args []string) {
-	var hops []WebRequestResult
-	var err error
-
-	for _, rawURL := range args {
-		newReq := globalRequestTemplate
-		newReq.url, err = checkURL(rawURL, false)
-		check(err, ErrNoURL)
-
-		// handle the request(s)
-		hops, err = getHops(newReq, cookieFlags.follow)
-		if err != nil {
-			pr.Error("%s", err.Error())
-			continue
-		}
+	saveCookies := cmd.Flags().Changed("save-cookies")
+	if saveCookies {
+		// response cookies must be stored to save them
+		ensureCookieJar()
+	}
 
-		// display results
-		prettyPrintCookies(hops)
+	renderer := newRenderer(prettyPrintCookies, bodyNone)
 
-		if cmd.Flags().Changed("save-cookies") {
-			lastHop := hops[len(hops)-1]
-			fmt.Printf("Save cookie list to %s: ", cookieFlags.SaveCookiesFName)
-			f, err := os.Create(cookieFlags.SaveCookiesFName)
-			check(err, ErrNoFile)
-			defer f.Close()
+	runURLs(cmd.Context(), args, false, cookieFlags.follow, renderer)
 
-			for _, c := range lastHop.cookieLst {
-				_, err = fmt.Fprintf(f, "%+v\n", c)
-				check(err, ErrFileIO)
-			}
+	if saveCookies {
+		if isTextOutput() {
+			fmt.Printf("Save cookie list to %s: ", cookieFlags.SaveCookiesFName)
+		}
+		check(globalConnSet.cookieJar.Save(cookieFlags.SaveCookiesFName), ErrFileIO)
+		if isTextOutput() {
 			fmt.Println("Done")
 		}
 	}
@@ -97,14 +89,80 @@ func makeCookiesFromNames(names []string, cookieList []*http.Cookie) []*http.Coo
 	return cl
 }
 
-func makeCookiesFromResponse(headers http.Header) []*http.Cookie {
-	var cl []*http.Cookie
+// chainPrintSetCookies shows the attributes of all Set-Cookie headers of a
+// response and flags violations
+func chainPrintSetCookies(indent, frameChar, mark, titleMsg string, cookieList []probe.SetCookie) {
+	fmtString := "%s%s   %s\n"
+	fmt.Printf(fmtString, indent, frameChar, at.Bold(titleMsg))
 
-	if cookieHeader := headers.Values("Set-Cookie"); len(cookieHeader) > 0 {
-		c := http.Cookie{Name: "Set-Cookie", Value: "xxxx"}
-		cl = append(cl, &c)
+	if len(cookieList) == 0 {
+		fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("%s %s", mark, "(None)"))
+		fmt.Printf("%s%s\n", indent, frameChar)
+		return
 	}
-	return cl
+
+	for _, c := range cookieList {
+		ckStr := fmt.Sprintf("%s: %s", c.Name, c.Value)
+		fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("%s %s", mark, shorten(rootFlags.long, screenWidth-25, ckStr)))
+
+		scope := fmt.Sprintf("Path=%s, Domain=%s", notAvailable(c.Path), c.Domain)
+		if c.Domain == "" {
+			scope = fmt.Sprintf("Path=%s, host only", notAvailable(c.Path))
+		}
+		fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("    Scope:    %s", scope))
+		fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("    Lifetime: %s", cookieLifetime(c)))
+		fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("    Flags:    %s", cookieFlagList(c)))
+
+		if c.Prefix != "" {
+			status := at.Green("ok")
+			if len(c.Issues) > 0 {
+				status = at.Red("violated")
+			}
+			fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("    Prefix:   %s (%s)", c.Prefix, status))
+		}
+
+		for _, is := range c.Issues {
+			fmt.Printf(fmtString, indent, frameChar, at.Red(fmt.Sprintf("    %s %s", at.Larrow, is)))
+		}
+	}
+	fmt.Printf("%s%s\n", indent, frameChar)
+}
+
+func cookieLifetime(c probe.SetCookie) string {
+	switch {
+	case c.Expired():
+		return at.Yellow("expired (deletes cookie)")
+	case c.MaxAge > 0:
+		return fmt.Sprintf("Max-Age=%d (%s)", c.MaxAge, time.Duration(c.MaxAge)*time.Second)
+	case !c.Expires.IsZero():
+		return fmt.Sprintf("Expires=%s (in %d day(s))", c.Expires.UTC().Format(time.RFC1123), int(time.Until(c.Expires).Hours()/24))
+	default:
+		return "session"
+	}
+}
+
+func cookieFlagList(c probe.SetCookie) string {
+	flag := func(set bool, name string) string {
+		if set {
+			return at.Green(name)
+		}
+		return at.Red("no " + name)
+	}
+
+	sameSite := at.Red("no SameSite")
+	if c.SameSite != "" {
+		sameSite = at.Green("SameSite=" + c.SameSite)
+		if c.SameSite == "None" {
+			sameSite = at.Yellow("SameSite=None")
+		}
+	}
+
+	flags := []string{flag(c.Secure, "Secure"), flag(c.HttpOnly, "HttpOnly"), sameSite}
+	if c.Partitioned {
+		flags = append(flags, at.Green("Partitioned"))
+	}
+
+	return strings.Join(flags, ", ")
 }
 
 func chainPrintCookies(indent, frameChar, mark, titleMsg string, cookieList []*http.Cookie) {
@@ -149,7 +207,7 @@ func prettyPrintCookies(resultList []WebRequestResult) {
 
 	for cnt, h := range resultList {
 		// result title
-		title := fmt.Sprintf("%d:  %s (%s)", cnt+1, h.PrettyPrintRedir(cnt), colorStatus(h.response.StatusCode))
+		title := fmt.Sprintf("%d:  %s (%s)", cnt+1, h.PrettyPrintRedir(cnt), colorStatus(h.Response.StatusCode))
 		titleLen := len(stripColorCodes(title))
 
 		fmt.Println(title)
@@ -165,19 +223,17 @@ func prettyPrintCookies(resultList []WebRequestResult) {
 func ckHandleCookies(result WebRequestResult) {
 	if len(cookieFlags.displaySingleCookie) == 0 {
 		// Request cookies from globalCookieList
-		chainPrintCookies(indentHeader, "", at.BulletChar, "Request Cookies:", result.request.Cookies())
+		chainPrintCookies(indentHeader, "", at.BulletChar, "Request Cookies:", displayCookies(result.Request.Cookies()))
 
 		// Set-Cookie in response headers?
-		responseCookies := makeCookiesFromResponse(result.response.Header)
-
-		if len(responseCookies) > 0 {
-			chainPrintHeaders(indentHeader, "", at.BulletChar, at.Yellow("Cookie Store Request Detected:"), makeHeadersFromName([]string{"Set-Cookie"}, result.response.Header))
+		if setCookies := result.SetCookies(); len(setCookies) > 0 {
+			chainPrintSetCookies(indentHeader, "", at.BulletChar, "Response Cookies (Set-Cookie):", setCookies)
 		}
 
-		if result.cookieLst != nil {
-			chainPrintCookies(indentHeader, "", at.BulletChar, "Stored Cookies:", result.cookieLst)
+		if result.Cookies != nil {
+			chainPrintCookies(indentHeader, "", at.BulletChar, "Stored Cookies:", result.Cookies)
 		}
 	} else {
-		chainPrintCookies(indentHeader, "", at.BulletChar, "Selected Cookies:", makeCookiesFromNames(cookieFlags.displaySingleCookie, result.cookieLst))
+		chainPrintCookies(indentHeader, "", at.BulletChar, "Selected Cookies:", makeCookiesFromNames(cookieFlags.displaySingleCookie, result.Cookies))
 	}
 }
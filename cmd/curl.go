@@ -0,0 +1,164 @@
+/*
+Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
+*/
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hleinders/htprobe/probe"
+)
+
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// shellQuote quotes str for a POSIX shell, if needed
+func shellQuote(str string) string {
+	if shellSafe.MatchString(str) {
+		return str
+	}
+
+	return "'" + strings.ReplaceAll(str, "'", `'\''`) + "'"
+}
+
+// curlSeconds formats a duration for curl's timeout options
+func curlSeconds(d time.Duration) string {
+	return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.3f", d.Seconds()), "0"), ".")
+}
+
+// curlCommand returns a curl command line doing the same request as r with
+// the global connection setup. Credentials are masked, unless
+// '--show-secrets' is given.
+func (r WebRequest) curlCommand(doFollow bool) string {
+	words := []string{"curl"}
+	add := func(w ...string) {
+		words = append(words, w...)
+	}
+
+	if doFollow {
+		add("-L")
+		if globalConnSet.maxRedirects != probe.DefaultMaxRedirects {
+			add("--max-redirs", fmt.Sprint(globalConnSet.maxRedirects))
+		}
+		if globalConnSet.keepMethod && r.method == "POST" {
+			add("--post301", "--post302")
+		}
+	}
+
+	// with '-X', curl keeps the method on every redirect; a POST is
+	// implied by the data instead, so curl changes it like htprobe does
+	hasData := methodNeedsBody(r.method) && r.reqBody != ""
+	switch r.method {
+	case "", "GET":
+	case "HEAD":
+		add("-I")
+	case "POST":
+		if !hasData {
+			add("-X", r.method)
+		}
+	default:
+		add("-X", r.method)
+	}
+
+	if r.agent != "" {
+		add("-A", r.agent)
+	}
+
+	if r.lang != "" {
+		add("-H", "Accept-Language: "+r.lang)
+	}
+
+	for _, s := range r.xhdrs {
+		n, v := splitFirst(s, globalHeaderSep)
+		n, v = strings.TrimSpace(n), strings.TrimSpace(v)
+		if !rootFlags.showSecrets {
+			v = probe.MaskHeaderValue(n, v)
+		}
+		add("-H", n+": "+v)
+	}
+
+	if r.authUser != "" {
+		pass := r.authPass
+		if pass != "" && !rootFlags.showSecrets {
+			pass = probe.SecretMask
+		}
+		add("-u", r.authUser+":"+pass)
+		if globalConnSet.digestOnly {
+			add("--digest")
+		}
+	}
+
+	if r.bearer != "" {
+		token := r.bearer
+		if !rootFlags.showSecrets {
+			token = probe.SecretMask
+		}
+		add("--oauth2-bearer", token)
+	}
+
+	if len(r.cookieLst) > 0 {
+		var cl []string
+		for _, c := range displayCookies(r.cookieLst) {
+			cl = append(cl, c.Name+"="+c.Value)
+		}
+		add("-b", strings.Join(cl, "; "))
+	}
+
+	if hasData {
+		add("--data-raw", r.reqBody)
+	}
+
+	// connection setup:
+	cs := globalConnSet
+	if rootFlags.cookieJarFile != "" {
+		add("-b", rootFlags.cookieJarFile, "-c", rootFlags.cookieJarFile)
+	} else if cs.acceptCookies {
+		// enables the cookie engine
+		add("-c", "/dev/null")
+	}
+	if cs.trust {
+		add("-k")
+	}
+	if rootFlags.certFile != "" || rootFlags.pkcs12 != "" {
+		cert := rootFlags.certFile
+		if rootFlags.pkcs12 != "" {
+			cert = rootFlags.pkcs12
+			add("--cert-type", "P12")
+		}
+		if rootFlags.keyPass != "" {
+			pass := rootFlags.keyPass
+			if !rootFlags.showSecrets {
+				pass = probe.SecretMask
+			}
+			cert += ":" + pass
+		}
+		add("--cert", cert)
+		if rootFlags.keyFile != "" {
+			add("--key", rootFlags.keyFile)
+		}
+	}
+	if cs.noHTTP2 {
+		add("--http1.1")
+	}
+	if cs.proxy != "" {
+		add("-x", cs.proxy)
+	}
+	if cs.connTimeOut > 0 {
+		add("--connect-timeout", curlSeconds(cs.connTimeOut))
+	}
+	if cs.maxTime > 0 {
+		add("-m", curlSeconds(cs.maxTime))
+	} else if cs.timeOut > 0 && !doFollow {
+		add("-m", curlSeconds(cs.timeOut))
+	}
+
+	add(r.url.String())
+
+	for i := range words {
+		words[i] = shellQuote(words[i])
+	}
+
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,28 @@
+/*
+Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
+*/
+package cmd
+
+import (
+	"github.com/hleinders/htprobe/probe"
+)
+
+// Return values for the error categories of the probe engine
+var errorKindCodes = map[probe.ErrorKind]int{
+	probe.KindUnknown:          ErrRequest,
+	probe.KindTimeout:          ErrTimeout,
+	probe.KindDNS:              ErrResolve,
+	probe.KindTLS:              ErrTLS,
+	probe.KindConnection:       ErrConnection,
+	probe.KindLocation:         ErrResponse,
+	probe.KindTooManyRedirects: ErrTooManyRedirects,
+	probe.KindURL:              ErrNoURL,
+	probe.KindCanceled:         ErrCanceled,
+	probe.KindAuth:             ErrAuth,
+	probe.KindRedirectLoop:     ErrTooManyRedirects,
+}
+
+// errorExitCode returns the program return value for any error
+func errorExitCode(err error) int {
+	return errorKindCodes[probe.KindOf(err)]
+}
@@ -0,0 +1,456 @@
+/*
+Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hleinders/htprobe/probe"
+	"github.com/spf13/cobra"
+)
+
+var fromCurlShortDesc = "Runs a curl command line through " + AppName
+
+// fromCurlCmd represents the from-curl command
+var fromCurlCmd = &cobra.Command{
+	Use:     "from-curl '<curl command>' | -- curl [options] <URL>",
+	Args:    cobra.MinimumNArgs(1),
+	Aliases: []string{"fc", "curl"},
+	Short:   fromCurlShortDesc,
+	Long: makeHeader(lowerAppName+" from-curl: "+fromCurlShortDesc) + `With command 'from-curl', a curl command line is translated into a
+request and the result is shown as redirect chain. Pass the command
+either quoted as a single argument, after '--' or as '-' to read it
+from stdin (line continuations with '\' are allowed).
+
+Supported curl options are: -X, -H, -b, -c, -d (--data, --data-raw,
+--data-binary, --data-urlencode), -u, --digest, --oauth2-bearer, -A, -e, -L, -I,
+-k, -x, -m, --connect-timeout, --http1.1 and --url. Cookie files for
+'-b' and '-c' are read and written in Netscape format. Options only changing curl's
+own output (-s, -v, -i, -o ...) are ignored.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ExecFromCurl(cmd, args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(fromCurlCmd)
+	addAssertionFlags(fromCurlCmd)
+}
+
+func ExecFromCurl(cmd *cobra.Command, args []string) {
+	words := args
+	if len(args) == 1 {
+		line := args[0]
+		if line == StdinName {
+			b, err := io.ReadAll(os.Stdin)
+			check(err, ErrFileIO)
+			line = string(b)
+		}
+
+		var err error
+		words, err = splitShellWords(line)
+		check(err, ErrGetFlag)
+	}
+
+	req, rawURL, doFollow, err := parseCurl(words)
+	check(err, ErrGetFlag)
+
+	if globalConnSet.acceptCookies {
+		ensureCookieJar()
+	}
+	for _, fname := range curlCookieFiles {
+		check(globalConnSet.cookieJar.Load(fname), ErrCookieJar)
+	}
+
+	// validate assertion flags:
+	al, err := makeAssertions(urlJob{})
+	check(err, ErrGetFlag)
+
+	res := urlResult{rawURL: rawURL}
+	req.url, err = checkURL(rawURL, false)
+	if err != nil {
+		res.err = &probe.Error{Kind: probe.KindURL, URL: rawURL, Err: err}
+	} else {
+		if rootFlags.asCurl {
+			res.curl = req.curlCommand(doFollow)
+		}
+		res.hops, res.err = getHops(cmd.Context(), req, doFollow)
+		res.assertions = evalAssertions(al, res.hops)
+	}
+
+	renderer := newRenderer(prettyPrintChain, bodyLast)
+	renderer.Render(res)
+	renderer.Finish()
+
+	switch {
+	case !res.ok():
+		globalExitCode = errorExitCode(res.err)
+	case !res.passed():
+		globalExitCode = ErrAssertion
+	}
+}
+
+// cookie files given with '-b', loaded into the cookie jar
+var curlCookieFiles []string
+
+// curl options taking a value
+var curlValueOpts = map[string]bool{
+	"-X": true, "--request": true,
+	"-H": true, "--header": true,
+	"-b": true, "--cookie": true,
+	"-d": true, "--data": true, "--data-raw": true, "--data-binary": true, "--data-ascii": true, "--data-urlencode": true,
+	"-u": true, "--user": true,
+	"--oauth2-bearer": true,
+	"-A":              true, "--user-agent": true,
+	"-e": true, "--referer": true,
+	"-x": true, "--proxy": true,
+	"-m": true, "--max-time": true,
+	"--connect-timeout": true,
+	"--url":             true,
+	"-o":                true, "--output": true,
+	"-w": true, "--write-out": true,
+	"-c": true, "--cookie-jar": true,
+}
+
+// curl options without a value, that are ignored
+var curlIgnoredOpts = map[string]bool{
+	"-s": true, "--silent": true,
+	"-S": true, "--show-error": true,
+	"-v": true, "--verbose": true,
+	"-i": true, "--include": true,
+	"-f": true, "--fail": true,
+	"-g": true, "--globoff": true,
+	"-#": true, "--progress-bar": true,
+	"--compressed": true, "--http2": true, "--basic": true,
+}
+
+// parseCurl translates the words of a curl command line into a request
+// based on the global request template. The connection setup (proxy,
+// timeouts etc.) is changed globally.
+func parseCurl(words []string) (WebRequest, string, bool, error) {
+	var rawURL string
+	var data []string
+	doFollow := false
+
+	req := globalRequestTemplate
+	req.method = ""
+	req.reqBody = ""
+	req.xhdrs = nil
+	req.cookieLst = nil
+
+	if len(words) > 0 && (words[0] == "curl" || strings.HasSuffix(words[0], "/curl")) {
+		words = words[1:]
+	}
+
+	words = append([]string(nil), words...)
+	for i := 0; i < len(words); i++ {
+		o := words[i]
+		var val string
+
+		// expand clusters like '-sSL' or '-XPOST', but not values:
+		if len(o) > 2 && strings.HasPrefix(o, "-") && !strings.HasPrefix(o, "--") {
+			words = append(words[:i], append(expandCurlCluster(o), words[i+1:]...)...)
+			o = words[i]
+		}
+
+		if curlValueOpts[o] {
+			if i+1 >= len(words) {
+				return req, "", false, fmt.Errorf("option %s needs a value", o)
+			}
+			i++
+			val = words[i]
+		}
+
+		switch o {
+		case "-X", "--request":
+			req.method = strings.ToUpper(val)
+		case "-H", "--header":
+			n, v := splitFirst(val, ":")
+			n, v = strings.TrimSpace(n), strings.TrimSpace(v)
+			switch http.CanonicalHeaderKey(n) {
+			case "User-Agent":
+				req.agent = v
+			case "Accept-Language":
+				req.lang = v
+			default:
+				req.xhdrs = append(req.xhdrs, n+globalHeaderSep+v)
+			}
+		case "-b", "--cookie":
+			if !strings.Contains(val, "=") {
+				// cookie file
+				globalConnSet.acceptCookies = true
+				curlCookieFiles = append(curlCookieFiles, val)
+				continue
+			}
+			for _, c := range strings.Split(val, ";") {
+				n, v := splitFirst(c, "=")
+				if strings.TrimSpace(n) != "" {
+					req.cookieLst = append(req.cookieLst, &http.Cookie{Name: strings.TrimSpace(n), Value: strings.TrimSpace(v)})
+				}
+			}
+		case "-d", "--data", "--data-ascii", "--data-binary", "--data-raw", "--data-urlencode":
+			d, err := curlData(o, val)
+			if err != nil {
+				return req, "", false, err
+			}
+			data = append(data, d)
+		case "-u", "--user":
+			u, p := splitFirst(val, ":")
+			if u == "" {
+				return req, "", false, errors.New("option -u needs 'user[:password]'")
+			}
+			// curl prompts for a missing password
+			if !strings.Contains(val, ":") {
+				if rootFlags.authPass == "" {
+					return req, "", false, errors.New("option -u without password needs '--pass', '--pass-file' or '--pass-env'")
+				}
+				p = rootFlags.authPass
+			}
+			req.authUser, req.authPass = u, p
+		case "--oauth2-bearer":
+			req.bearer = val
+		case "-A", "--user-agent":
+			req.agent = val
+		case "-e", "--referer":
+			req.xhdrs = append(req.xhdrs, "Referer"+globalHeaderSep+val)
+		case "-x", "--proxy":
+			if strings.Contains(val, "://") && !strings.HasPrefix(val, "http://") {
+				return req, "", false, fmt.Errorf("unsupported proxy: %s", val)
+			}
+			globalConnSet.proxy = strings.TrimSuffix(strings.TrimPrefix(val, "http://"), "/")
+		case "-m", "--max-time":
+			d, err := curlDuration(val)
+			if err != nil {
+				return req, "", false, err
+			}
+			globalConnSet.maxTime = d
+		case "--connect-timeout":
+			d, err := curlDuration(val)
+			if err != nil {
+				return req, "", false, err
+			}
+			globalConnSet.connTimeOut = d
+		case "-c", "--cookie-jar":
+			globalConnSet.acceptCookies = true
+			if rootFlags.cookieJarFile == "" && val != "-" {
+				rootFlags.cookieJarFile = val
+			}
+		case "-L", "--location":
+			doFollow = true
+		case "-I", "--head":
+			req.method = "HEAD"
+		case "-k", "--insecure":
+			globalConnSet.trust = true
+		case "--digest":
+			globalConnSet.digestOnly = true
+		case "--http1.1":
+			globalConnSet.noHTTP2 = true
+		case "--url":
+			if rawURL != "" {
+				return req, "", false, errors.New("only one URL is supported")
+			}
+			rawURL = val
+		case "-o", "--output", "-w", "--write-out":
+			// output of curl itself
+		default:
+			switch {
+			case curlIgnoredOpts[o]:
+			case strings.HasPrefix(o, "-") && o != StdinName:
+				return req, "", false, fmt.Errorf("unsupported curl option: %s", o)
+			case rawURL != "":
+				return req, "", false, errors.New("only one URL is supported")
+			default:
+				rawURL = o
+			}
+		}
+	}
+
+	if rawURL == "" {
+		return req, "", false, errors.New("no URL in curl command")
+	}
+
+	if len(data) > 0 {
+		req.reqBody = strings.Join(data, "&")
+		if req.method == "" {
+			req.method = "POST"
+		}
+
+		// like curl, unless given with '-H'
+		hasType := false
+		for _, h := range append(req.xhdrs, globalHeaderList...) {
+			n, _ := splitFirst(h, globalHeaderSep)
+			hasType = hasType || strings.EqualFold(strings.TrimSpace(n), "Content-Type")
+		}
+		if !hasType {
+			req.xhdrs = append(req.xhdrs, "Content-Type"+globalHeaderSep+"application/x-www-form-urlencoded")
+		}
+	}
+	if req.method == "" {
+		req.method = "GET"
+	}
+
+	if !findInSlice(getMethodNames(), req.method) {
+		return req, "", false, fmt.Errorf("unknown http method: %s", req.method)
+	}
+
+	req.xhdrs = append(req.xhdrs, globalHeaderList...)
+	req.cookieLst = append(req.cookieLst, globalCookieLst...)
+
+	return req, rawURL, doFollow, nil
+}
+
+// expandCurlCluster splits combined short options like '-sSL' into single
+// options; the rest of the word after an option taking a value is its value
+func expandCurlCluster(w string) []string {
+	var opts []string
+
+	for j := 1; j < len(w); j++ {
+		o := "-" + string(w[j])
+		opts = append(opts, o)
+		if curlValueOpts[o] {
+			if j+1 < len(w) {
+				opts = append(opts, w[j+1:])
+			}
+			break
+		}
+	}
+
+	return opts
+}
+
+// curlData handles the value of a data option like curl does: '@file'
+// reads a file, '-d' strips line breaks and '--data-urlencode' encodes
+func curlData(opt, val string) (string, error) {
+	if opt == "--data-urlencode" {
+		n, v := splitFirst(val, "=")
+		if !strings.Contains(val, "=") {
+			return url.QueryEscape(val), nil
+		}
+		if n == "" {
+			return url.QueryEscape(v), nil
+		}
+		return n + "=" + url.QueryEscape(v), nil
+	}
+
+	if opt == "--data-raw" || !strings.HasPrefix(val, "@") {
+		return val, nil
+	}
+
+	var b []byte
+	var err error
+	if val == "@-" {
+		b, err = io.ReadAll(os.Stdin)
+	} else {
+		b, err = os.ReadFile(val[1:])
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if opt == "--data-binary" {
+		return string(b), nil
+	}
+
+	return strings.NewReplacer("\r", "", "\n", "").Replace(string(b)), nil
+}
+
+func curlDuration(val string) (time.Duration, error) {
+	secs, err := strconv.ParseFloat(val, 64)
+	if err != nil || secs < 0 {
+		return 0, fmt.Errorf("invalid timeout: %s", val)
+	}
+
+	return time.Duration(secs * float64(time.Second)), nil
+}
+
+// splitShellWords splits a command line like a POSIX shell does, including
+// quotes, backslash escapes and line continuations
+func splitShellWords(line string) ([]string, error) {
+	var words []string
+	var cur strings.Builder
+	inWord := false
+
+	const (
+		none = iota
+		single
+		double
+	)
+	quote := none
+
+	rs := []rune(line)
+	for i := 0; i < len(rs); i++ {
+		c := rs[i]
+
+		switch quote {
+		case single:
+			if c == '\'' {
+				quote = none
+			} else {
+				cur.WriteRune(c)
+			}
+			continue
+		case double:
+			switch {
+			case c == '"':
+				quote = none
+			case c == '\\' && i+1 < len(rs) && strings.ContainsRune("\"\\$`\n", rs[i+1]):
+				i++
+				if rs[i] != '\n' {
+					cur.WriteRune(rs[i])
+				}
+			default:
+				cur.WriteRune(c)
+			}
+			continue
+		}
+
+		switch {
+		case c == '\\':
+			if i+1 < len(rs) {
+				i++
+				if rs[i] == '\n' || rs[i] == '\r' {
+					// line continuation
+					if rs[i] == '\r' && i+1 < len(rs) && rs[i+1] == '\n' {
+						i++
+					}
+					continue
+				}
+				cur.WriteRune(rs[i])
+				inWord = true
+			}
+		case c == '\'':
+			quote = single
+			inWord = true
+		case c == '"':
+			quote = double
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(c)
+			inWord = true
+		}
+	}
+
+	if quote != none {
+		return words, errors.New("unterminated quote in command line")
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+
+	return words, nil
+}
@@ -4,14 +4,15 @@ Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
 package cmd
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net/http"
-	"net/http/cookiejar"
 	"net/url"
 	"strings"
 	"time"
 
 	at "github.com/hleinders/AnsiTerm"
+	"github.com/hleinders/htprobe/probe"
 )
 
 // Return values
@@ -29,6 +30,15 @@ const (
 	ErrFileIO
 	ErrNoFile
 	ErrNoMethod
+	ErrOutput
+	ErrAssertion
+	ErrTimeout
+	ErrTLS
+	ErrConnection
+	ErrTooManyRedirects
+	ErrCanceled
+	ErrAuth
+	ErrDiverged
 )
 
 const (
@@ -36,7 +46,6 @@ const (
 	AppVersion               = "1.19 (2026-06-26)"
 	Author                   = "Harald Leinders <harald@leinders.de>"
 	DefaultConnectionTimeout = 3
-	MaxRedirects             = 25
 	MaxHeaderLen             = 30
 )
 
@@ -47,12 +56,50 @@ type RequestMethod struct {
 
 type ConnectionSetup struct {
 	timeOut       time.Duration
+	connTimeOut   time.Duration
+	tlsTimeOut    time.Duration
+	headerTimeOut time.Duration
+	maxTime       time.Duration
 	proxy         string
+	resolve       map[string]string
 	trust         bool
-	follow        bool
 	acceptCookies bool
 	noHTTP2       bool
-	cookieJar     *cookiejar.Jar
+	maxRedirects  int
+	keepMethod    bool
+	followMeta    bool
+	digestOnly    bool
+	cookieJar     *probe.Jar
+	oauth2        *probe.OAuth2
+	clientCert    *tls.Certificate
+}
+
+// options converts the connection setup for the probe engine
+func (cs ConnectionSetup) options() probe.Options {
+	opts := probe.Options{
+		Timeout:               cs.timeOut,
+		ConnectTimeout:        cs.connTimeOut,
+		TLSHandshakeTimeout:   cs.tlsTimeOut,
+		ResponseHeaderTimeout: cs.headerTimeOut,
+		MaxTime:               cs.maxTime,
+		Proxy:                 cs.proxy,
+		Resolve:               cs.resolve,
+		Insecure:              cs.trust,
+		DisableHTTP2:          cs.noHTTP2,
+		OAuth2:                cs.oauth2,
+		ClientCertificate:     cs.clientCert,
+		MaxRedirects:          cs.maxRedirects,
+		KeepMethod:            cs.keepMethod,
+		FollowMeta:            cs.followMeta,
+		DigestOnly:            cs.digestOnly,
+		Debugf:                pr.Debug,
+	}
+
+	if cs.acceptCookies && cs.cookieJar != nil {
+		opts.Jar = cs.cookieJar
+	}
+
+	return opts
 }
 
 type WebRequest struct {
@@ -62,6 +109,7 @@ type WebRequest struct {
 	method    string
 	authUser  string
 	authPass  string
+	bearer    string
 	reqBody   string
 	xhdrs     []string
 	cookieLst []*http.Cookie
@@ -71,28 +119,93 @@ func (r WebRequest) String() string {
 	return fmt.Sprintf("%s (%s)", r.url.String(), r.method)
 }
 
+// probeRequest converts the request for the probe engine
+func (r WebRequest) probeRequest(doFollow bool) probe.Request {
+	preq := probe.Request{
+		URL:         r.url,
+		Method:      r.method,
+		UserAgent:   r.agent,
+		Language:    r.lang,
+		User:        r.authUser,
+		Password:    r.authPass,
+		BearerToken: r.bearer,
+		Header:      http.Header{},
+		Cookies:     r.cookieLst,
+		Follow:      doFollow,
+	}
+
+	if methodNeedsBody(r.method) {
+		preq.Body = r.reqBody
+	}
+
+	for _, s := range r.xhdrs {
+		n, v := splitFirst(s, globalHeaderSep)
+		preq.Header.Set(strings.TrimSpace(n), strings.TrimSpace(v))
+	}
+
+	return preq
+}
+
+// WebRequestResult is a single hop of a request chain
 type WebRequestResult struct {
-	request   http.Request
-	response  http.Response
-	cookieLst []*http.Cookie
+	probe.Hop
+	// loopHop is the hop number (starting at 1), if the hop is part of a
+	// redirect loop
+	loopHop int
 }
 
 func (r WebRequestResult) String() string {
-	return fmt.Sprintf("%s (%s)", r.request.URL.String(), r.response.Status)
+	return fmt.Sprintf("%s (%s)", r.Request.URL.String(), r.Response.Status)
 }
 
 func (r WebRequestResult) GetRequest() string {
-	reqStr := r.request.URL.String()
+	reqStr := r.Request.URL.String()
 
 	if rootFlags.resolve {
-		reqStr = fmt.Sprintf("%s (%s)", reqStr, doResolve(r.request.URL.Hostname()))
+		ips, err := doResolve(r.Request.URL.Hostname())
+		if err != nil {
+			ips = at.Red(err.Error())
+		}
+		reqStr = fmt.Sprintf("%s (%s)", reqStr, ips)
 	}
 
 	return reqStr
 }
 
+// GetNotes returns the remarks of the probe engine for display
+func (r WebRequestResult) GetNotes() string {
+	if len(r.Notes) == 0 {
+		return ""
+	}
+
+	return "  " + at.Cyan("("+strings.Join(r.Notes, ", ")+")")
+}
+
+// GetWarnings returns the warnings of the probe engine as badges
+func (r WebRequestResult) GetWarnings() string {
+	var badges []string
+
+	for _, w := range r.Warnings {
+		badges = append(badges, at.Yellow("["+w+"]"))
+	}
+	if len(badges) == 0 {
+		return ""
+	}
+
+	return "  " + strings.Join(badges, " ")
+}
+
+// GetLoopMark returns the hop number of a hop within a redirect loop
+func (r WebRequestResult) GetLoopMark() string {
+	if r.loopHop == 0 {
+		return ""
+	}
+
+	return "  " + at.Red(fmt.Sprintf("[%d]", r.loopHop))
+}
+
 func (r WebRequestResult) PrettyPrintFirst() string {
-	return fmt.Sprintf(at.Bold("URL: %s  [%s: %s]"), r.GetRequest(), r.request.Method, r.response.Proto)
+	return fmt.Sprintf(at.Bold("URL: %s  [%s: %s]"), r.GetRequest(), r.Request.Method, r.Response.Proto) + r.GetLoopMark() + r.GetNotes()
 }
 
 func (r WebRequestResult) PrettyPrintRedir(num int) string {
@@ -100,15 +213,25 @@ func (r WebRequestResult) PrettyPrintRedir(num int) string {
 		return r.PrettyPrintFirst()
 	}
 
-	return at.Yellow("Redirect to: ") + fmt.Sprintf(at.Bold("%s  [%s: %s]"), r.GetRequest(), r.request.Method, r.response.Proto)
+	title := "Redirect to: "
+	if r.MetaRefresh {
+		title = "Refresh to: "
+	}
+
+	return at.Yellow(title) + fmt.Sprintf(at.Bold("%s  [%s: %s]"), r.GetRequest(), r.Request.Method, r.Response.Proto) + r.GetLoopMark() + r.GetNotes()
 }
 
 func (r WebRequestResult) PrettyPrintNormal(lastStatusCode int) string {
-	return fmt.Sprintf("%s%s (%s) %s  [%s: %s] %s", htab, hcont, colorStatus(lastStatusCode), rarrow, r.request.Method, r.response.Proto, r.GetRequest())
+	status := colorStatus(lastStatusCode)
+	if r.MetaRefresh {
+		status += at.Yellow(" meta")
+	}
+
+	return fmt.Sprintf("%s%s (%s) %s  [%s: %s] %s", htab, hcont, status, rarrow, r.Request.Method, r.Response.Proto, r.GetRequest()) + r.GetLoopMark() + r.GetNotes()
 }
 
 func (r WebRequestResult) PrettyPrintLast() string {
-	return fmt.Sprintf("%s%s (%s) %s  %s", htab, corner, colorStatus(r.response.StatusCode), rarrow, at.Bold(r.response.Status))
+	return fmt.Sprintf("%s%s (%s) %s  %s", htab, corner, colorStatus(r.Response.StatusCode), rarrow, at.Bold(r.Response.Status))
 }
 
 var AllowedHttpMethods = []RequestMethod{
@@ -130,6 +253,7 @@ var (
 	rqCookiesDone         = false
 	colorMode             = true
 	globalConnSet         ConnectionSetup
+	globalExitCode        = OK
 	globalRequestBody     string
 	globalRequestTemplate = WebRequest{}
 	globalHeaderList      []string
@@ -0,0 +1,58 @@
+/*
+Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/hleinders/htprobe/probe"
+	"github.com/spf13/cobra"
+)
+
+// DefaultHARBodyLimit is the max. size of a response body in a HAR file
+const DefaultHARBodyLimit = 64 * 1024
+
+var harFileName string
+var harBodyLimit int
+
+// addHARFlags adds the '--har' flags to a subcommand
+func addHARFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&harFileName, "har", "", "write all hops as HAR 1.2 archive to `file`")
+	cmd.Flags().IntVar(&harBodyLimit, "har-body-limit", DefaultHARBodyLimit, "max. `bytes` of a response body in the HAR file (-1=unlimited)")
+}
+
+// writeHAR saves the results as HAR archive, if '--har' was given. Every
+// URL becomes a page, every hop an entry.
+func writeHAR(results []urlResult) {
+	if harFileName == "" {
+		return
+	}
+
+	har := probe.NewHAR(AppName, AppVersion)
+	for _, res := range results {
+		var chain probe.Chain
+		for _, h := range res.hops {
+			chain.Hops = append(chain.Hops, h.Hop)
+		}
+		har.AddChain(res.rawURL, chain, harBodyLimit)
+	}
+
+	if !rootFlags.showSecrets {
+		har.MaskSecrets()
+	}
+
+	f, err := os.Create(harFileName)
+	check(err, ErrFileIO)
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	check(enc.Encode(har), ErrFileIO)
+
+	if isTextOutput() {
+		fmt.Printf("HAR archive written to %s\n", harFileName)
+	}
+}
@@ -5,7 +5,6 @@ package cmd
 
 import (
 	"fmt"
-	"io"
 	"net/http"
 	"os"
 	"sort"
@@ -28,12 +27,14 @@ var headerShortDesc = "Shows the request and response headers of a http request"
 // headersCmd represents the headers command
 var headersCmd = &cobra.Command{
 	Use:     "headers <URL> [<URL> ...]",
-	Args:    cobra.MinimumNArgs(1),
+	Args:    urlArgs,
 	Aliases: []string{"hd", "hdr", "head"},
 	Short:   headerShortDesc,
 	Long: makeHeader(lowerAppName+" headers: "+headerShortDesc) + `With command 'headers', all request and response headers
 are shown. You may pass the '-f|--follow' flag to follow redirects.
 In this case, the headers are displayed in any hop.
+URLs may also be read from a file with '--url-file' or from stdin
+with '-' as URL.
 
 Flags marked with '***' may be used multiple times.`,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -43,6 +44,9 @@ Flags marked with '***' may be used multiple times.`,
 
 func init() {
 	rootCmd.AddCommand(headersCmd)
+	addURLFileFlag(headersCmd)
+	addAssertionFlags(headersCmd)
+	addHARFlags(headersCmd)
 
 	// flags
 	headersCmd.Flags().BoolVarP(&headerFlags.follow, "follow", "f", false, "show headers for all hops")
@@ -53,37 +57,25 @@ func init() {
 }
 
 func ExecHeaders(cmd *cobra.Command, args []string) {
-	var hops []WebRequestResult
-	var err error
-
-	for _, rawURL := range args {
-		newReq := globalRequestTemplate
-		newReq.url, err = checkURL(rawURL, false)
-		check(err, ErrNoURL)
-
-		// handle the request(s)
-		hops, err = getHops(newReq, headerFlags.follow)
-		if err != nil {
-			pr.Error("%s", err.Error())
-			continue
-		}
+	bodyMode := bodyNone
+	if headerFlags.showContent {
+		bodyMode = bodyLast
+	}
+	renderer := newRenderer(prettyPrintHeadersWithContent, bodyMode)
 
-		// display results
-		prettyPrintHeaders(hops)
-
-		if headerFlags.showContent {
-			lastHop := hops[len(hops)-1]
-			body, err := io.ReadAll(lastHop.response.Body)
-			if err != nil {
-				pr.Errorln("%s", err)
-			} else {
-				fmt.Fprintln(os.Stderr)
-				fmt.Fprintln(os.Stderr, at.Bold("Content:"))
-				fmt.Fprintln(os.Stderr, at.Bold(strings.Repeat(at.FrameOHLine, 8)))
-				fmt.Fprintf(os.Stderr, "\n%+v\n", string(body))
-			}
-		}
+	results := runURLs(cmd.Context(), args, false, headerFlags.follow, renderer)
+	writeHAR(results)
+}
+
+func prettyPrintHeadersWithContent(resultList []WebRequestResult) {
+	prettyPrintHeaders(resultList)
 
+	if headerFlags.showContent {
+		lastHop := resultList[len(resultList)-1]
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, at.Bold("Content:"))
+		fmt.Fprintln(os.Stderr, at.Bold(strings.Repeat(at.FrameOHLine, 8)))
+		fmt.Fprintf(os.Stderr, "\n%+v\n", string(lastHop.Body))
 	}
 }
 
@@ -128,7 +120,7 @@ func prettyPrintHeaders(resultList []WebRequestResult) {
 
 	for cnt, h := range resultList {
 
-		title := fmt.Sprintf("%d:  %s (%s)", cnt+1, h.PrettyPrintRedir(cnt), colorStatus(h.response.StatusCode))
+		title := fmt.Sprintf("%d:  %s (%s)", cnt+1, h.PrettyPrintRedir(cnt), colorStatus(h.Response.StatusCode))
 		titleLen := len(stripColorCodes(title))
 
 		fmt.Println(title)
@@ -141,9 +133,9 @@ func prettyPrintHeaders(resultList []WebRequestResult) {
 
 func hdHandleHeaders(result WebRequestResult) {
 	if len(headerFlags.displaySingleHeader) == 0 {
-		chainPrintHeaders(indentHeader, "", at.BulletChar, "Request Header:", result.request.Header)
-		chainPrintHeaders(indentHeader, "", at.BulletChar, "Response Header:", result.response.Header)
+		chainPrintHeaders(indentHeader, "", at.BulletChar, "Request Header:", displayHeader(result.Request.Header))
+		chainPrintHeaders(indentHeader, "", at.BulletChar, "Response Header:", result.Response.Header)
 	} else {
-		chainPrintHeaders(indentHeader, "", at.BulletChar, "Selected Headers:", makeHeadersFromName(headerFlags.displaySingleHeader, result.response.Header))
+		chainPrintHeaders(indentHeader, "", at.BulletChar, "Selected Headers:", makeHeadersFromName(headerFlags.displaySingleHeader, result.Response.Header))
 	}
 }
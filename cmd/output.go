@@ -0,0 +1,342 @@
+/*
+Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
+*/
+package cmd
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hleinders/htprobe/probe"
+)
+
+// Output formats
+const (
+	OutputText   = "text"
+	OutputJSON   = "json"
+	OutputNDJSON = "ndjson"
+)
+
+var OutputFormats = []string{OutputText, OutputJSON, OutputNDJSON}
+
+// Which response bodies go into machine readable output
+const (
+	bodyNone = iota
+	bodyLast
+	bodyAll
+)
+
+// A Renderer displays the result of one probed URL per call to Render.
+// Finish is called once after the last result has been rendered.
+type Renderer interface {
+	Render(res urlResult)
+	Finish()
+}
+
+// textRenderer wraps the colored tree printers (prettyPrintChain etc.)
+type textRenderer struct {
+	pretty func(resultList []WebRequestResult)
+}
+
+func (r *textRenderer) Render(res urlResult) {
+	if res.curl != "" {
+		fmt.Printf("\n%s\n", res.curl)
+	}
+
+	if len(res.hops) > 0 {
+		r.pretty(res.hops)
+	}
+
+	if res.audit != nil {
+		chainPrintAudit(indentHeader, "", "Security Audit:", *res.audit)
+		fmt.Println()
+	}
+
+	if !res.ok() {
+		pr.Errorln("%s: %s", res.rawURL, res.err.Error())
+	}
+
+	if len(res.assertions) > 0 {
+		chainPrintAssertions(indentHeader, "", "Assertions:", res.assertions)
+		fmt.Println()
+	}
+}
+
+func (r *textRenderer) Finish() {}
+
+// jsonRenderer serializes every result as a ChainRecord. In json mode, all
+// chains are collected and written as one array on Finish, in ndjson mode
+// each chain is written as a single line as soon as it is rendered.
+type jsonRenderer struct {
+	out      io.Writer
+	ndjson   bool
+	bodyMode int
+	chains   []ChainRecord
+}
+
+func (r *jsonRenderer) Render(res urlResult) {
+	rec := makeChainRecord(res, r.bodyMode)
+
+	if r.ndjson {
+		r.write(rec)
+		return
+	}
+
+	r.chains = append(r.chains, rec)
+}
+
+func (r *jsonRenderer) Finish() {
+	if r.ndjson {
+		return
+	}
+
+	if r.chains == nil {
+		r.chains = []ChainRecord{}
+	}
+
+	r.write(r.chains)
+}
+
+func (r *jsonRenderer) write(v any) {
+	writeJSON(r.out, v, !r.ndjson)
+}
+
+// writeJSON encodes v, indented or as a single line
+func writeJSON(out io.Writer, v any, indent bool) {
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	if indent {
+		enc.SetIndent("", "  ")
+	}
+
+	check(enc.Encode(v), ErrFileIO)
+}
+
+// newRenderer returns the renderer for the selected output format. The
+// pretty printer is used for text output, bodyMode selects the response
+// bodies included in json output.
+func newRenderer(pretty func(resultList []WebRequestResult), bodyMode int) Renderer {
+	switch rootFlags.output {
+	case OutputJSON, OutputNDJSON:
+		return &jsonRenderer{out: os.Stdout, ndjson: rootFlags.output == OutputNDJSON, bodyMode: bodyMode}
+	default:
+		return &textRenderer{pretty: pretty}
+	}
+}
+
+func isTextOutput() bool {
+	return rootFlags.output == OutputText
+}
+
+// =================================== Output Records ==================================
+type ChainRecord struct {
+	Step       string             `json:"step,omitempty"`
+	URL        string             `json:"url"`
+	Curl       string             `json:"curl,omitempty"`
+	Hops       []HopRecord        `json:"hops"`
+	Error      string             `json:"error,omitempty"`
+	ErrorKind  string             `json:"error_kind,omitempty"`
+	Assertions []AssertionResult  `json:"assertions,omitempty"`
+	Audit      *probe.AuditReport `json:"audit,omitempty"`
+	Variables  map[string]string  `json:"variables,omitempty"`
+	// Loop holds the indices of the hops forming a redirect loop
+	Loop []int `json:"loop,omitempty"`
+}
+
+type HopRecord struct {
+	URL             string            `json:"url"`
+	Method          string            `json:"method"`
+	Proto           string            `json:"proto"`
+	Status          int               `json:"status"`
+	StatusText      string            `json:"status_text"`
+	RequestHeaders  http.Header       `json:"request_headers"`
+	ResponseHeaders http.Header       `json:"response_headers"`
+	RequestCookies  []CookieRecord    `json:"request_cookies"`
+	Cookies         []CookieRecord    `json:"cookies"`
+	SetCookies      []probe.SetCookie `json:"set_cookies"`
+	TLS             *TLSRecord        `json:"tls,omitempty"`
+	Timing          TimingRecord      `json:"timing"`
+	Body            *string           `json:"body,omitempty"`
+	MetaRefresh     bool              `json:"meta_refresh,omitempty"`
+	Retry           bool              `json:"retry,omitempty"`
+	Notes           []string          `json:"notes,omitempty"`
+	Warnings        []string          `json:"warnings,omitempty"`
+}
+
+type CookieRecord struct {
+	Name     string     `json:"name"`
+	Value    string     `json:"value"`
+	Path     string     `json:"path,omitempty"`
+	Domain   string     `json:"domain,omitempty"`
+	Expires  *time.Time `json:"expires,omitempty"`
+	MaxAge   int        `json:"max_age,omitempty"`
+	Secure   bool       `json:"secure,omitempty"`
+	HttpOnly bool       `json:"http_only,omitempty"`
+}
+
+type TLSRecord struct {
+	Version     string   `json:"version"`
+	CipherSuite string   `json:"cipher_suite"`
+	ServerName  string   `json:"server_name"`
+	ALPN        string   `json:"alpn,omitempty"`
+	CommonName  string   `json:"common_name"`
+	SANs        []string `json:"sans"`
+	NotBefore   string   `json:"not_before"`
+	NotAfter    string   `json:"not_after"`
+	Issuer      string   `json:"issuer"`
+	Chain       []string `json:"chain"`
+	// ClientAuth is missing, if the connection was reused
+	ClientAuth *ClientAuthRecord `json:"client_auth,omitempty"`
+}
+
+type ClientAuthRecord struct {
+	Requested     bool     `json:"requested"`
+	AcceptableCAs []string `json:"acceptable_cas,omitempty"`
+	Sent          bool     `json:"sent"`
+}
+
+type TimingRecord struct {
+	DNSMs      float64 `json:"dns_ms"`
+	ConnectMs  float64 `json:"connect_ms"`
+	TLSMs      float64 `json:"tls_ms"`
+	TTFBMs     float64 `json:"ttfb_ms"`
+	TransferMs float64 `json:"transfer_ms"`
+	TotalMs    float64 `json:"total_ms"`
+	RemoteAddr string  `json:"remote_addr,omitempty"`
+	ConnReused bool    `json:"conn_reused"`
+}
+
+func makeChainRecord(res urlResult, bodyMode int) ChainRecord {
+	rec := ChainRecord{Step: res.step, URL: res.rawURL, Curl: res.curl, Hops: []HopRecord{}, Variables: displayVariables(res.vars, res.secretVars)}
+
+	if len(res.hops) > 0 {
+		rec.URL = res.hops[0].Request.URL.String()
+	}
+
+	if !res.ok() {
+		rec.Error = res.err.Error()
+		rec.ErrorKind = probe.KindOf(res.err).String()
+	}
+
+	rec.Assertions = res.assertions
+	rec.Audit = res.audit
+
+	for _, n := range loopHops(res.hops) {
+		rec.Loop = append(rec.Loop, n-1)
+	}
+
+	last := len(res.hops) - 1
+	for i, h := range res.hops {
+		withBody := bodyMode == bodyAll || (bodyMode == bodyLast && i == last)
+		rec.Hops = append(rec.Hops, makeHopRecord(h, withBody))
+	}
+
+	return rec
+}
+
+func makeHopRecord(h WebRequestResult, withBody bool) HopRecord {
+	rec := HopRecord{
+		URL:             h.Request.URL.String(),
+		Method:          h.Request.Method,
+		Proto:           h.Response.Proto,
+		Status:          h.Response.StatusCode,
+		StatusText:      strings.TrimSpace(strings.TrimPrefix(h.Response.Status, fmt.Sprint(h.Response.StatusCode))),
+		RequestHeaders:  displayHeader(h.Request.Header),
+		ResponseHeaders: h.Response.Header,
+		RequestCookies:  makeCookieRecords(displayCookies(h.Request.Cookies())),
+		Cookies:         makeCookieRecords(h.Cookies),
+		SetCookies:      h.SetCookies(),
+		TLS:             makeTLSRecord(h.Response.TLS, h.ClientAuth),
+		Timing:          makeTimingRecord(h.Timing),
+		MetaRefresh:     h.MetaRefresh,
+		Retry:           h.Retry,
+		Notes:           h.Notes,
+		Warnings:        h.Warnings,
+	}
+
+	if withBody {
+		s := string(h.Body)
+		rec.Body = &s
+	}
+
+	return rec
+}
+
+func makeCookieRecords(cookieList []*http.Cookie) []CookieRecord {
+	cl := []CookieRecord{}
+
+	for _, c := range cookieList {
+		cr := CookieRecord{
+			Name:     c.Name,
+			Value:    c.Value,
+			Path:     c.Path,
+			Domain:   c.Domain,
+			MaxAge:   c.MaxAge,
+			Secure:   c.Secure,
+			HttpOnly: c.HttpOnly,
+		}
+		if !c.Expires.IsZero() {
+			exp := c.Expires
+			cr.Expires = &exp
+		}
+		cl = append(cl, cr)
+	}
+
+	return cl
+}
+
+func makeTLSRecord(state *tls.ConnectionState, ca *probe.ClientAuth) *TLSRecord {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+
+	c0 := state.PeerCertificates[0]
+	rec := TLSRecord{
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		ServerName:  state.ServerName,
+		ALPN:        state.NegotiatedProtocol,
+		CommonName:  c0.Subject.CommonName,
+		SANs:        c0.DNSNames,
+		NotBefore:   c0.NotBefore.UTC().Format(time.RFC3339),
+		NotAfter:    c0.NotAfter.UTC().Format(time.RFC3339),
+		Issuer:      c0.Issuer.CommonName,
+	}
+
+	if rec.SANs == nil {
+		rec.SANs = []string{}
+	}
+
+	for _, c := range state.PeerCertificates {
+		rec.Chain = append(rec.Chain, c.Subject.CommonName)
+	}
+
+	if ca != nil {
+		rec.ClientAuth = &ClientAuthRecord{Requested: ca.Requested, AcceptableCAs: ca.AcceptableCAs, Sent: ca.Sent}
+	}
+
+	return &rec
+}
+
+func makeTimingRecord(tm probe.Timing) TimingRecord {
+	return TimingRecord{
+		DNSMs:      durationMs(tm.DNS()),
+		ConnectMs:  durationMs(tm.Connect()),
+		TLSMs:      durationMs(tm.TLS()),
+		TTFBMs:     durationMs(tm.Wait()),
+		TransferMs: durationMs(tm.Transfer()),
+		TotalMs:    durationMs(tm.Total()),
+		RemoteAddr: tm.RemoteAddr,
+		ConnReused: tm.ConnReused,
+	}
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
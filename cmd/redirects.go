@@ -5,7 +5,6 @@ package cmd
 
 import (
 	"fmt"
-	"io"
 	"os"
 	"strings"
 
@@ -17,6 +16,7 @@ type RedirectFlags struct {
 	showResponseHeader, showRequestHeader    bool
 	showResponseCookies, showResponseCert    bool
 	allHops, showContent, showRequestCookies bool
+	showTiming                               bool
 	displaySingleHeader, displaySingleCookie []string
 }
 
@@ -27,7 +27,7 @@ var redirectShortDesc = "Follows and shows the redirect chain of a http request"
 // redirectsCmd represents the redirects command
 var redirectsCmd = &cobra.Command{
 	Use:     "redirects <URL> [<URL> ...]",
-	Args:    cobra.MinimumNArgs(1),
+	Args:    urlArgs,
 	Aliases: []string{"rd", "redir", "redirect"},
 	Short:   redirectShortDesc,
 	Long: makeHeader(lowerAppName+" redirects: "+redirectShortDesc) + `With command 'redirects', the redirect chain of a http
@@ -35,6 +35,8 @@ request is shown. Every hop of this chain is displayed with the status code.
 If the request is done via SSL and he certificate is invalid for some reason,
 you may use the '-t|--trust' flag to force the connection to be trusted.
 You can also display details like headers or cookies.
+URLs may also be read from a file with '--url-file' or from stdin
+with '-' as URL.
 
 Flags marked with '***' may be used multiple times.`,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -44,6 +46,9 @@ Flags marked with '***' may be used multiple times.`,
 
 func init() {
 	rootCmd.AddCommand(redirectsCmd)
+	addURLFileFlag(redirectsCmd)
+	addAssertionFlags(redirectsCmd)
+	addHARFlags(redirectsCmd)
 
 	// flags
 	redirectsCmd.Flags().BoolVarP(&redirectFlags.showResponseCookies, "show-cookies", "d", false, "show response cookies")
@@ -53,6 +58,7 @@ func init() {
 	redirectsCmd.Flags().BoolVarP(&redirectFlags.showRequestCookies, "request-cookies", "Z", false, "show request cookies")
 	redirectsCmd.Flags().BoolVarP(&redirectFlags.showContent, "show-content", "O", false, "show content of last hop (prints to stderr)")
 	redirectsCmd.Flags().BoolVarP(&redirectFlags.allHops, "all", "a", false, "show all details")
+	redirectsCmd.Flags().BoolVar(&redirectFlags.showTiming, "timing", false, "show timing waterfall for every hop")
 
 	// parameter
 	redirectsCmd.Flags().StringSliceVarP(&redirectFlags.displaySingleHeader, "display-header", "S", nil, "show only response header `FOOBAR`; ***")
@@ -60,42 +66,31 @@ func init() {
 }
 
 func ExecRedirects(cmd *cobra.Command, args []string) {
-	var hops []WebRequestResult
-	var err error
-
 	// singleHeader implies show ResponseHeaders:
 	redirectFlags.showResponseHeader = redirectFlags.showResponseHeader || len(redirectFlags.displaySingleHeader) > 0
 
 	// the same holds for cookies:
 	redirectFlags.showResponseCookies = redirectFlags.showResponseCookies || len(redirectFlags.displaySingleCookie) > 0
 
-	for _, rawURL := range args {
-		newReq := globalRequestTemplate
-		newReq.url, err = checkURL(rawURL, false)
-		check(err, ErrNoURL)
+	bodyMode := bodyNone
+	if redirectFlags.showContent {
+		bodyMode = bodyLast
+	}
+	renderer := newRenderer(prettyPrintChainWithContent, bodyMode)
 
-		// handle the request(s)
-		hops, err = getHops(newReq, true)
-		if err != nil {
-			pr.Error("%s", err.Error())
-			continue
-		}
+	results := runURLs(cmd.Context(), args, false, true, renderer)
+	writeHAR(results)
+}
 
-		// display results
-		prettyPrintChain(hops)
-
-		if redirectFlags.showContent {
-			lastHop := hops[len(hops)-1]
-			body, err := io.ReadAll(lastHop.response.Body)
-			if err != nil {
-				pr.Errorln("%s", err)
-			} else {
-				fmt.Fprintln(os.Stderr)
-				fmt.Fprintln(os.Stderr, at.Bold("Content:"))
-				fmt.Fprintln(os.Stderr, at.Bold(strings.Repeat(at.FrameOHLine, 8)))
-				fmt.Fprintf(os.Stderr, "\n%+v\n", string(body))
-			}
-		}
+func prettyPrintChainWithContent(resultList []WebRequestResult) {
+	prettyPrintChain(resultList)
+
+	if redirectFlags.showContent {
+		lastHop := resultList[len(resultList)-1]
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, at.Bold("Content:"))
+		fmt.Fprintln(os.Stderr, at.Bold(strings.Repeat(at.FrameOHLine, 8)))
+		fmt.Fprintf(os.Stderr, "\n%+v\n", string(lastHop.Body))
 	}
 }
 
@@ -115,57 +110,88 @@ func prettyPrintChain(resultList []WebRequestResult) {
 	rqCookiesDone = true
 
 	// remember status
-	lastStatusCode = first.response.StatusCode
+	lastStatusCode = first.Response.StatusCode
 
-	// no do the remaining
+	// no do the remaining, the warnings about a Location are shown
+	// with its target
 	if numItem >= 1 {
 		for i, h := range resultList[1:] {
-			fmt.Println(h.PrettyPrintNormal(lastStatusCode))
+			fmt.Println(h.PrettyPrintNormal(lastStatusCode) + resultList[i].GetWarnings())
 
 			showResponse := (i == numItem-1) || redirectFlags.allHops
 			rdHandleHeaders(h, showResponse)
 
-			lastStatusCode = h.response.StatusCode
+			lastStatusCode = h.Response.StatusCode
 		}
 	}
 
-	// last status:
-	fmt.Println(resultList[numItem].PrettyPrintLast())
+	// last status, e.g. with a missing Location:
+	fmt.Println(resultList[numItem].PrettyPrintLast() + resultList[numItem].GetWarnings())
+
+	// redirect loop, closed by its first hop:
+	if loop := loopHops(resultList); len(loop) > 0 {
+		var marks []string
+		for _, n := range append(loop, loop[0]) {
+			marks = append(marks, fmt.Sprintf("[%d]", n))
+		}
+		fmt.Printf("%s%s %s\n", htab, at.Red(at.Bold("Redirect loop:")), strings.Join(marks, " "+at.Harrow+" "))
+	}
 	fmt.Println()
 }
 
+// loopHops returns the numbers of the hops forming a redirect loop
+func loopHops(resultList []WebRequestResult) []int {
+	var loop []int
+
+	for _, h := range resultList {
+		if h.loopHop > 0 {
+			loop = append(loop, h.loopHop)
+		}
+	}
+
+	return loop
+}
+
 func rdHandleHeaders(result WebRequestResult, showResponse bool) {
 	// Request stuff:
 	// Request headers: May only occour on first hop
 	if redirectFlags.showRequestHeader && !rqHeaderDone {
-		chainPrintHeaders(htab, vbar, at.BulletChar, "Request Header:", result.request.Header)
+		chainPrintHeaders(htab, vbar, at.BulletChar, "Request Header:", displayHeader(result.Request.Header))
 	}
 
 	if redirectFlags.showRequestCookies && !rqCookiesDone {
-		chainPrintCookies(htab, vbar, at.BulletChar, "Request Cookies:", result.request.Cookies())
+		chainPrintCookies(htab, vbar, at.BulletChar, "Request Cookies:", displayCookies(result.Request.Cookies()))
+	}
+
+	// Timing: Shown for every hop
+	if redirectFlags.showTiming {
+		chainPrintTiming(htab, vbar, at.BulletChar, "Timing:", result.Timing)
 	}
 
 	// Response stuff
 	// Response certificates: May occour in all hops or only at last hop
 	if redirectFlags.showResponseCert && showResponse {
-		chainPrintCertificates(htab, vbar, at.BulletChar, "Certificate(s):", result.response.TLS)
+		chainPrintCertificates(htab, vbar, at.BulletChar, "Certificate(s):", result.Response.TLS, result.ClientAuth)
 	}
 
 	// Response Headers: May occour in all hops or only at last hop
 	if redirectFlags.showResponseHeader && showResponse {
 		if len(redirectFlags.displaySingleHeader) == 0 {
-			chainPrintHeaders(htab, vbar, at.BulletChar, "Response Header:", result.response.Header)
+			chainPrintHeaders(htab, vbar, at.BulletChar, "Response Header:", result.Response.Header)
 		} else {
-			chainPrintHeaders(htab, vbar, at.BulletChar, "Selected Headers:", makeHeadersFromName(redirectFlags.displaySingleHeader, result.response.Header))
+			chainPrintHeaders(htab, vbar, at.BulletChar, "Selected Headers:", makeHeadersFromName(redirectFlags.displaySingleHeader, result.Response.Header))
 		}
 	}
 
 	// Response cookies: May occour in all hops or only at last hop
 	if redirectFlags.showResponseCookies && showResponse {
 		if len(redirectFlags.displaySingleCookie) == 0 {
-			chainPrintCookies(htab, vbar, at.BulletChar, "Stored Cookies:", result.cookieLst)
+			if setCookies := result.SetCookies(); len(setCookies) > 0 {
+				chainPrintSetCookies(htab, vbar, at.BulletChar, "Response Cookies (Set-Cookie):", setCookies)
+			}
+			chainPrintCookies(htab, vbar, at.BulletChar, "Stored Cookies:", result.Cookies)
 		} else {
-			chainPrintCookies(htab, vbar, at.BulletChar, "Selected Cookies:", makeCookiesFromNames(redirectFlags.displaySingleCookie, result.cookieLst))
+			chainPrintCookies(htab, vbar, at.BulletChar, "Selected Cookies:", makeCookiesFromNames(redirectFlags.displaySingleCookie, result.Cookies))
 		}
 	}
 }
@@ -0,0 +1,370 @@
+/*
+Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	at "github.com/hleinders/AnsiTerm"
+	"github.com/hleinders/htprobe/probe"
+	"github.com/spf13/cobra"
+)
+
+type ReplayFlags struct {
+	entries       []int
+	ignoreHeaders []string
+}
+
+var replayFlags ReplayFlags
+
+var replayShortDesc = "Replays the requests of a HAR file and compares the responses"
+
+// replayCmd represents the replay command
+var replayCmd = &cobra.Command{
+	Use:     "replay <HAR file> [<HAR file> ...]",
+	Args:    cobra.MinimumNArgs(1),
+	Aliases: []string{"rp", "har"},
+	Short:   replayShortDesc,
+	Long: makeHeader(lowerAppName+" replay: "+replayShortDesc) + `With command 'replay', every request of a HAR archive (e.g. exported
+from the devtools of a browser) is sent again with its method, headers,
+cookies and body. Redirects are not followed, because every hop is an
+entry of its own. The recorded and the live response are compared:
+status, redirect target and response headers.
+Use '-' as file name to read the archive from stdin. Global flags like
+'--rq-header' are added to the recorded request.
+
+Flags marked with '***' may be used multiple times.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ExecReplay(cmd, args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(replayCmd)
+
+	// Parameter
+	replayCmd.Flags().IntSliceVarP(&replayFlags.entries, "entry", "e", nil, "replay only entry `N` (starting with 1); ***")
+	replayCmd.Flags().StringSliceVar(&replayFlags.ignoreHeaders, "ignore-header", []string{"Date", "Age"}, "do not compare response header `FOOBAR`; ***")
+}
+
+// HeaderDiff is a response header, that differs between record and replay.
+// Recorded or Live is empty, if the header is missing.
+type HeaderDiff struct {
+	Name     string `json:"name"`
+	Recorded string `json:"recorded"`
+	Live     string `json:"live"`
+}
+
+// ReplayRecord is the comparison of a single HAR entry
+type ReplayRecord struct {
+	Entry            int          `json:"entry"`
+	Method           string       `json:"method"`
+	URL              string       `json:"url"`
+	RecordedStatus   int          `json:"recorded_status"`
+	LiveStatus       int          `json:"live_status,omitempty"`
+	RecordedLocation string       `json:"recorded_location,omitempty"`
+	LiveLocation     string       `json:"live_location,omitempty"`
+	Headers          []HeaderDiff `json:"header_diff"`
+	Error            string       `json:"error,omitempty"`
+	ErrorKind        string       `json:"error_kind,omitempty"`
+
+	err error
+}
+
+func (r ReplayRecord) ok() bool {
+	return r.err == nil
+}
+
+func (r ReplayRecord) differs() bool {
+	return r.RecordedStatus != r.LiveStatus || r.RecordedLocation != r.LiveLocation || len(r.Headers) > 0
+}
+
+func ExecReplay(cmd *cobra.Command, args []string) {
+	var records []ReplayRecord
+
+	for _, fname := range args {
+		har := readHARFile(fname)
+
+		for i, entry := range har.Log.Entries {
+			if len(replayFlags.entries) > 0 && !slices.Contains(replayFlags.entries, i+1) {
+				continue
+			}
+
+			rec := replayEntry(cmd.Context(), i+1, entry)
+			if isTextOutput() {
+				prettyPrintReplay(rec)
+			} else if rootFlags.output == OutputNDJSON {
+				writeJSON(os.Stdout, rec, false)
+			}
+			records = append(records, rec)
+		}
+	}
+
+	if rootFlags.output == OutputJSON {
+		if records == nil {
+			records = []ReplayRecord{}
+		}
+		writeJSON(os.Stdout, records, true)
+	}
+
+	if len(records) == 0 {
+		check(errors.New("no HAR entries to replay"), ErrNoURL)
+	}
+
+	printReplaySummary(records)
+
+	for _, r := range records {
+		if !r.ok() {
+			globalExitCode = errorExitCode(r.err)
+			break
+		}
+	}
+}
+
+func readHARFile(fname string) *probe.HAR {
+	var r io.Reader = os.Stdin
+
+	if fname != StdinName {
+		f, err := os.Open(fname)
+		check(err, ErrNoFile)
+		defer f.Close()
+		r = f
+	}
+
+	har, err := probe.ReadHAR(r)
+	check(err, ErrFileIO)
+
+	return har
+}
+
+// harRequest rebuilds the recorded request of entry. Host, length and
+// HTTP/2 pseudo headers are left to the transport.
+func harRequest(entry probe.HAREntry) (WebRequest, error) {
+	req := globalRequestTemplate
+	req.xhdrs = nil
+	req.cookieLst = nil
+	req.reqBody = ""
+
+	u, err := url.Parse(entry.Request.URL)
+	if err != nil {
+		return req, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return req, fmt.Errorf("not an absolute URL: %s", entry.Request.URL)
+	}
+	req.url = *u
+	req.method = strings.ToUpper(entry.Request.Method)
+
+	// Accept-Encoding is left to the transport, that decodes gzip like the
+	// browser did for the recorded content
+	for _, h := range entry.Request.Headers {
+		name := http.CanonicalHeaderKey(h.Name)
+		switch {
+		case strings.HasPrefix(h.Name, ":"), name == "Host", name == "Content-Length", name == "Cookie", name == "Connection", name == "Accept-Encoding":
+			continue
+		case name == "User-Agent":
+			req.agent = h.Value
+		case name == "Accept-Language":
+			req.lang = h.Value
+		default:
+			req.xhdrs = append(req.xhdrs, name+globalHeaderSep+h.Value)
+		}
+	}
+	req.xhdrs = append(req.xhdrs, globalHeaderList...)
+
+	for _, c := range entry.Request.Cookies {
+		req.cookieLst = append(req.cookieLst, &http.Cookie{Name: c.Name, Value: c.Value})
+	}
+	req.cookieLst = append(req.cookieLst, globalCookieLst...)
+
+	if entry.Request.PostData != nil {
+		req.reqBody = entry.Request.PostData.Text
+	}
+
+	return req, nil
+}
+
+func replayEntry(ctx context.Context, num int, entry probe.HAREntry) ReplayRecord {
+	rec := ReplayRecord{
+		Entry:          num,
+		Method:         entry.Request.Method,
+		URL:            entry.Request.URL,
+		RecordedStatus: entry.Response.Status,
+		Headers:        []HeaderDiff{},
+	}
+
+	req, err := harRequest(entry)
+	if err != nil {
+		rec.err = &probe.Error{Kind: probe.KindURL, URL: entry.Request.URL, Err: err}
+	} else {
+		var hops []WebRequestResult
+		hops, rec.err = getHops(ctx, req, false)
+		if len(hops) > 0 {
+			live := hops[0].Response
+			rec.LiveStatus = live.StatusCode
+			rec.LiveLocation = resolveLocation(req.url, live.Header.Get("Location"))
+			rec.Headers = diffHeaders(harHeaderMap(entry.Response.Headers), live.Header, replayFlags.ignoreHeaders)
+		}
+		rec.RecordedLocation = resolveLocation(req.url, entry.Response.RedirectURL)
+	}
+
+	if rec.err != nil {
+		rec.Error = rec.err.Error()
+		rec.ErrorKind = probe.KindOf(rec.err).String()
+	}
+
+	return rec
+}
+
+// resolveLocation makes relative redirect targets comparable
+func resolveLocation(base url.URL, loc string) string {
+	if loc == "" {
+		return ""
+	}
+
+	u, err := url.Parse(loc)
+	if err != nil {
+		return loc
+	}
+
+	return base.ResolveReference(u).String()
+}
+
+func harHeaderMap(list []probe.HARNameValue) http.Header {
+	hdr := http.Header{}
+
+	for _, h := range list {
+		if !strings.HasPrefix(h.Name, ":") {
+			hdr.Add(h.Name, h.Value)
+		}
+	}
+
+	return hdr
+}
+
+// diffHeaders lists all headers with different values, sorted by name.
+// The headers in ignore are skipped.
+func diffHeaders(recorded, live http.Header, ignore []string) []HeaderDiff {
+	diffs := []HeaderDiff{}
+	names := map[string]bool{}
+
+	for n := range recorded {
+		names[n] = true
+	}
+	for n := range live {
+		names[n] = true
+	}
+
+	var sorted []string
+	for n := range names {
+		if !isIgnoredHeader(n, ignore) {
+			sorted = append(sorted, n)
+		}
+	}
+	sort.Strings(sorted)
+
+	for _, n := range sorted {
+		rv := strings.Join(recorded.Values(n), ", ")
+		lv := strings.Join(live.Values(n), ", ")
+		if rv != lv {
+			diffs = append(diffs, HeaderDiff{Name: n, Recorded: rv, Live: lv})
+		}
+	}
+
+	return diffs
+}
+
+func isIgnoredHeader(name string, ignore []string) bool {
+	for _, h := range ignore {
+		if strings.EqualFold(strings.TrimSpace(h), name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func prettyPrintReplay(rec ReplayRecord) {
+	fmtString := "%s%s   %s\n"
+
+	fmt.Println()
+	title := fmt.Sprintf("%d:  %s", rec.Entry, at.Bold(fmt.Sprintf("%s %s", rec.Method, rec.URL)))
+	fmt.Println(title)
+	fmt.Println(strings.Repeat(at.FrameOHLine, len(stripColorCodes(title))))
+	fmt.Println()
+
+	if !rec.ok() {
+		pr.Errorln("%s", rec.Error)
+		return
+	}
+
+	result := at.Green("identical")
+	if rec.differs() {
+		result = at.Yellow("different")
+	}
+	fmt.Printf(fmtString, indentHeader, "", fmt.Sprintf("%s %-10s %s", at.BulletChar, "Result:", result))
+	fmt.Printf(fmtString, indentHeader, "", fmt.Sprintf("%s %-10s %s %s %s", at.BulletChar, "Status:", colorStatus(rec.RecordedStatus), rarrow, colorStatus(rec.LiveStatus)))
+
+	if rec.RecordedLocation != "" || rec.LiveLocation != "" {
+		loc := fmt.Sprintf("%s %s %s", notAvailable(rec.RecordedLocation), rarrow, notAvailable(rec.LiveLocation))
+		if rec.RecordedLocation != rec.LiveLocation {
+			loc = at.Yellow(loc)
+		}
+		fmt.Printf(fmtString, indentHeader, "", fmt.Sprintf("%s %-10s %s", at.BulletChar, "Location:", loc))
+	}
+
+	if len(rec.Headers) > 0 {
+		fmt.Printf(fmtString, indentHeader, "", fmt.Sprintf("%s %s", at.BulletChar, "Headers:"))
+	}
+	for _, d := range rec.Headers {
+		var line string
+		switch {
+		case d.Recorded == "":
+			line = at.Green(fmt.Sprintf("+ %s: %s", d.Name, d.Live))
+		case d.Live == "":
+			line = at.Red(fmt.Sprintf("- %s: %s", d.Name, d.Recorded))
+		default:
+			line = at.Yellow(fmt.Sprintf("~ %s: %s %s %s", d.Name, d.Recorded, rarrow, d.Live))
+		}
+		fmt.Printf(fmtString, indentHeader, "", "    "+shorten(rootFlags.long, screenWidth-15, line))
+	}
+}
+
+func printReplaySummary(records []ReplayRecord) {
+	var different, failed int
+
+	for _, r := range records {
+		switch {
+		case !r.ok():
+			failed++
+		case r.differs():
+			different++
+		}
+	}
+
+	// keep machine readable output clean
+	var out io.Writer = os.Stdout
+	if !isTextOutput() {
+		out = os.Stderr
+	}
+
+	fmtString := "%s%s   %s\n"
+
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, at.Bold("Summary:"))
+	fmt.Fprintf(out, fmtString, indentHeader, "", fmt.Sprintf("%s Entries:   %d", at.BulletChar, len(records)))
+	fmt.Fprintf(out, fmtString, indentHeader, "", fmt.Sprintf("%s Identical: %s", at.BulletChar, at.Green(fmt.Sprint(len(records)-different-failed))))
+	fmt.Fprintf(out, fmtString, indentHeader, "", fmt.Sprintf("%s Different: %s", at.BulletChar, at.Yellow(fmt.Sprint(different))))
+	fmt.Fprintf(out, fmtString, indentHeader, "", fmt.Sprintf("%s Failed:    %s", at.BulletChar, at.Red(fmt.Sprint(failed))))
+	fmt.Fprintln(out)
+}
@@ -5,27 +5,37 @@ package cmd
 
 import (
 	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"net/http/cookiejar"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/fatih/color"
 	at "github.com/hleinders/AnsiTerm"
 	cp "github.com/hleinders/colorprint"
-	"golang.org/x/net/publicsuffix"
+	"github.com/hleinders/htprobe/probe"
 
 	"github.com/spf13/cobra"
 )
 
 type RootFlags struct {
+	parallel                              int
 	debug, verbose                        bool
 	noColor, noFancy, ascii               bool
-	resolve, long                         bool
-	agent, reqLang, httpMethod            string
-	authUser, authPass                    string
+	resolve, long, asCurl, showSecrets    bool
+	agent, reqLang, httpMethod, output    string
+	authUser, authPass, passFile, passEnv string
+	bearer, oauthTokenURL                 string
+	clientID, clientSecret                string
+	scopes                                []string
+	certFile, keyFile, keyPass, pkcs12    string
 	cookieFile, bodyFile, headerFile      string
+	cookieJarFile                         string
 	cookieValues, bodyValues, xtraHeaders []string
 }
 
@@ -47,7 +57,8 @@ be examined and displayed. You can show and search for headers or
 cookies, display certificates or follow a redirect chain.
 
 Flags marked with '***' may be used multiple times.`,
-	PersistentPreRun: PersistentPreRun,
+	PersistentPreRun:  PersistentPreRun,
+	PersistentPostRun: PersistentPostRun,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
@@ -56,12 +67,35 @@ Flags marked with '***' may be used multiple times.`,
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	err := rootCmd.Execute()
+	// Ctrl-C cancels all pending requests, a second one kills the program
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
 	if err != nil {
 		os.Exit(1)
 	}
 }
 
+// groups of global flags, that are mutually exclusive or required together.
+// They are also used to skip the profile flags overridden on the command
+// line.
+var (
+	exclusiveFlags = [][]string{
+		{"pass", "pass-file", "pass-env"},
+		{"user", "bearer", "oauth-token-url"},
+		{"cert", "pkcs12"},
+		{"key", "pkcs12"},
+	}
+	requiredTogetherFlags = [][]string{
+		{"oauth-token-url", "client-id", "client-secret"},
+	}
+)
+
 func init() {
 	// flags
 	rootCmd.PersistentFlags().BoolVarP(&rootFlags.verbose, "verbose", "v", false, "set verbose mode")
@@ -74,33 +108,67 @@ func init() {
 	rootCmd.PersistentFlags().BoolVarP(&rootFlags.resolve, "show-ip", "i", false, "resolve host names to show IP(s)")
 	rootCmd.PersistentFlags().BoolVarP(&rootFlags.long, "long", "l", false, "long output, don't shorten results (header, cookies etc.)")
 	rootCmd.PersistentFlags().BoolVarP(&globalConnSet.acceptCookies, "accept-cookies", "A", false, "accept response cookies")
+	rootCmd.PersistentFlags().BoolVar(&rootFlags.asCurl, "as-curl", false, "show the equivalent curl command for every URL")
+	rootCmd.PersistentFlags().BoolVar(&rootFlags.showSecrets, "show-secrets", false, "do not mask credentials (Authorization, Cookie ...) in the output")
 
 	// Parameter
-	rootCmd.PersistentFlags().StringVarP(&rootFlags.authUser, "user", "u", "", "`user` (basic auth)")
-	rootCmd.PersistentFlags().StringVarP(&rootFlags.authPass, "pass", "p", "", "`password` (basic auth)")
+	rootCmd.PersistentFlags().StringVarP(&rootFlags.authUser, "user", "u", "", "`user` (basic auth, digest on a 401 challenge)")
+	rootCmd.PersistentFlags().StringVarP(&rootFlags.authPass, "pass", "p", "", "`password` (basic or digest auth)")
+	rootCmd.PersistentFlags().StringVar(&rootFlags.passFile, "pass-file", "", "read password from first line of `file`")
+	rootCmd.PersistentFlags().StringVar(&rootFlags.passEnv, "pass-env", "", "read password from environment `variable`")
+	rootCmd.PersistentFlags().BoolVar(&globalConnSet.digestOnly, "digest", false, "send '--user' and password only to answer a digest challenge, never as basic auth")
+	rootCmd.PersistentFlags().StringVar(&rootFlags.bearer, "bearer", "", "send `token` as 'Authorization: Bearer' (may be '${ENV}')")
+	rootCmd.PersistentFlags().StringVar(&rootFlags.oauthTokenURL, "oauth-token-url", "", "fetch a bearer token from `URL` (OAuth2 client credentials)")
+	rootCmd.PersistentFlags().StringVar(&rootFlags.clientID, "client-id", "", "OAuth2 client `id`")
+	rootCmd.PersistentFlags().StringVar(&rootFlags.clientSecret, "client-secret", "", "OAuth2 client `secret` (may be '${ENV}')")
+	rootCmd.PersistentFlags().StringSliceVar(&rootFlags.scopes, "scope", nil, "request OAuth2 `scope`; ***")
+	rootCmd.PersistentFlags().StringVar(&rootFlags.certFile, "cert", "", "send client certificate from PEM `file` (mTLS)")
+	rootCmd.PersistentFlags().StringVar(&rootFlags.keyFile, "key", "", "read private key of '--cert' from PEM `file`, optionally encrypted (default: cert file)")
+	rootCmd.PersistentFlags().StringVar(&rootFlags.pkcs12, "pkcs12", "", "send client certificate from PKCS#12 `file` (mTLS)")
+	rootCmd.PersistentFlags().StringVar(&rootFlags.keyPass, "key-pass", "", "`password` of the private key or PKCS#12 file (may be '${ENV}')")
 	rootCmd.PersistentFlags().StringVar(&rootFlags.agent, "agent", agentString, "user agent")
 	rootCmd.PersistentFlags().StringVarP(&rootFlags.reqLang, "lang", "L", "", "set `language` header for request")
 	rootCmd.PersistentFlags().StringVarP(&globalConnSet.proxy, "proxy", "P", "", "set `host(:port)` as proxy")
 	rootCmd.PersistentFlags().IntVarP(&connTimeout, "timeout", "T", DefaultConnectionTimeout, "connection `time`out in seconds (0=disable, <=3600)")
+	rootCmd.PersistentFlags().DurationVar(&globalConnSet.connTimeOut, "connect-timeout", 0, "tcp connect `timeout` (e.g. 500ms, 0=disable)")
+	rootCmd.PersistentFlags().DurationVar(&globalConnSet.tlsTimeOut, "tls-timeout", 0, "tls handshake `timeout` (e.g. 1.5s, 0=disable)")
+	rootCmd.PersistentFlags().DurationVar(&globalConnSet.headerTimeOut, "response-header-timeout", 0, "`timeout` waiting for response headers (0=disable)")
+	rootCmd.PersistentFlags().DurationVar(&globalConnSet.maxTime, "max-time", 0, "total `time` for a request chain incl. redirects (0=disable)")
+	rootCmd.PersistentFlags().IntVar(&globalConnSet.maxRedirects, "max-redirects", probe.DefaultMaxRedirects, "follow at most `N` redirects (>=1)")
+	rootCmd.PersistentFlags().BoolVar(&globalConnSet.keepMethod, "keep-method", false, "keep POST and its body on 301/302 redirects (default: change to GET)")
+	rootCmd.PersistentFlags().BoolVar(&globalConnSet.followMeta, "follow-meta", false, "also follow 'Refresh' headers and HTML meta refresh")
 	rootCmd.PersistentFlags().StringVarP(&rootFlags.httpMethod, "method", "m", "GET", "http request `method` (see RFC 7231 section 4.3.)")
 	rootCmd.PersistentFlags().StringSliceVarP(&rootFlags.cookieValues, "rq-cookie", "q", nil, "set request cookie (fmt: `name"+globalCookieSep+"value`); ***")
+	rootCmd.PersistentFlags().StringVar(&rootFlags.cookieJarFile, "cookie-jar", "", "load cookies from and save them to `file` (Netscape cookies.txt, JSON if *.json); implies -A")
 	rootCmd.PersistentFlags().StringVarP(&rootFlags.cookieFile, "rq-cookie-file", "Q", "", "read request cookies from `file` (fmt: lines of 'name"+globalCookieSep+"value')")
 	rootCmd.PersistentFlags().StringSliceVarP(&rootFlags.bodyValues, "rq-body", "b", nil, "add `entry` to request body where needed (e.g. POST); ***")
 	rootCmd.PersistentFlags().StringVarP(&rootFlags.bodyFile, "rq-body-file", "B", "", "read request body from `file`")
 	rootCmd.PersistentFlags().StringSliceVarP(&rootFlags.xtraHeaders, "rq-header", "x", nil, "pass extra `header` to request (fmt: 'name:value'); ***")
+	rootCmd.PersistentFlags().IntVar(&rootFlags.parallel, "parallel", 1, "probe up to `N` URLs in parallel")
+	rootCmd.PersistentFlags().StringVar(&rootFlags.output, "output", OutputText, "output `format` ("+strings.Join(OutputFormats, ", ")+")")
 	rootCmd.PersistentFlags().StringVarP(&rootFlags.headerFile, "rq-header-file", "X", "", "read extra request headers from `file` (fmt: lines of 'name:value')")
+	rootCmd.PersistentFlags().StringVar(&configFileName, "config", "", "read profiles from config `file` (default: "+defaultConfigFile()+")")
+	rootCmd.PersistentFlags().StringVar(&profileName, "profile", "", "use flags of profile `name` from the config file (default: '"+DefaultProfile+"', if present)")
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
 	// rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 
 	rootCmd.PersistentFlags().MarkHidden("debug")
-	rootCmd.MarkFlagsRequiredTogether("user", "pass")
+	for _, g := range exclusiveFlags {
+		rootCmd.MarkFlagsMutuallyExclusive(g...)
+	}
+	for _, g := range requiredTogetherFlags {
+		rootCmd.MarkFlagsRequiredTogether(g...)
+	}
 }
 
 func PersistentPreRun(cmd *cobra.Command, args []string) {
 	var err error
 	var cookieStringList, bodyList, headerStringList []string
 
+	// config file: fills all global flags not given on the command line
+	check(applyProfile(cmd.Root().PersistentFlags()), ErrGetFlag)
+
 	// handle fancy stuff
 	color.NoColor = rootFlags.noColor || at.NoColor()
 	colorMode = !color.NoColor
@@ -130,11 +198,17 @@ func PersistentPreRun(cmd *cobra.Command, args []string) {
 	pr.SetVerbose(rootFlags.verbose)
 	pr.SetDebug(rootFlags.debug)
 
+	if activeProfile != "" {
+		pr.Debug("Using profile '%s' from %s\n", activeProfile, activeConfigFile)
+	}
+
 	globalConnSet.timeOut, err = time.ParseDuration(fmt.Sprintf("%ds", connTimeout))
 	check(err, ErrTimeFmt)
-	if globalConnSet.acceptCookies {
-		globalConnSet.cookieJar, err = cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
-		check(err, ErrCookieJar)
+	if globalConnSet.acceptCookies || rootFlags.cookieJarFile != "" {
+		ensureCookieJar()
+	}
+	if rootFlags.cookieJarFile != "" {
+		check(globalConnSet.cookieJar.Load(rootFlags.cookieJarFile), ErrCookieJar)
 	}
 
 	//
@@ -159,6 +233,8 @@ func PersistentPreRun(cmd *cobra.Command, args []string) {
 			check(err0, ErrNoFile)
 		}
 	}
+	headerStringList, err = expandEnvList(headerStringList)
+	check(err, ErrGetFlag)
 	globalHeaderList = headerStringList
 	pr.Debug("Request headers from flags: \n%s\n", globalHeaderList)
 
@@ -185,6 +261,9 @@ func PersistentPreRun(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	cookieStringList, err = expandEnvList(cookieStringList)
+	check(err, ErrGetFlag)
+
 	if len(cookieStringList) > 0 {
 		for _, ci := range cookieStringList {
 			c, err := getCookieFromString(ci)
@@ -220,6 +299,8 @@ func PersistentPreRun(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	bodyList, err = expandEnvList(bodyList)
+	check(err, ErrGetFlag)
 	globalRequestBody = strings.Join(bodyList, "\n")
 	pr.Debug("Request body from flags: \n%s\n", globalRequestBody)
 
@@ -244,6 +325,90 @@ func PersistentPreRun(cmd *cobra.Command, args []string) {
 		os.Exit(ErrNoMethod)
 	}
 
+	// Handle redirect limit:
+	if globalConnSet.maxRedirects < 1 {
+		check(fmt.Errorf("invalid redirect limit: %d", globalConnSet.maxRedirects), ErrGetFlag)
+	}
+
+	// Handle parallel workers:
+	if rootFlags.parallel < 1 {
+		rootFlags.parallel = 1
+	}
+
+	// Handle output format:
+	rootFlags.output = strings.ToLower(rootFlags.output)
+	if !findInSlice(OutputFormats, rootFlags.output) {
+		fmt.Printf(at.Bold(at.Yellow("\nUnknown output format: %s.\n")), rootFlags.output)
+		fmt.Printf("Must be one of: %s\n\n", strings.Join(OutputFormats, ", "))
+
+		os.Exit(ErrOutput)
+	}
+
+	//
+	// Handle password sources:
+	switch {
+	case rootFlags.passFile != "":
+		data, err := os.ReadFile(rootFlags.passFile)
+		check(err, ErrNoFile)
+		rootFlags.authPass, _, _ = strings.Cut(string(data), "\n")
+		rootFlags.authPass = strings.TrimSuffix(rootFlags.authPass, "\r")
+	case rootFlags.passEnv != "":
+		pass, ok := os.LookupEnv(rootFlags.passEnv)
+		if !ok {
+			check(fmt.Errorf("environment variable not set: %s", rootFlags.passEnv), ErrGetFlag)
+		}
+		rootFlags.authPass = pass
+	}
+
+	// from-curl takes the user from curl's '-u'
+	if (rootFlags.authUser == "") != (rootFlags.authPass == "") && (rootFlags.authUser != "" || cmd.Name() != "from-curl") {
+		check(errors.New("auth needs '--user' and a password ('--pass', '--pass-file' or '--pass-env')"), ErrGetFlag)
+	}
+
+	//
+	// Handle token auth:
+	rootFlags.bearer, err = expandEnv(rootFlags.bearer)
+	check(err, ErrGetFlag)
+
+	if rootFlags.oauthTokenURL != "" {
+		secret, err := expandEnv(rootFlags.clientSecret)
+		check(err, ErrGetFlag)
+
+		tokenURL, err := checkURL(rootFlags.oauthTokenURL, true)
+		check(err, ErrNoURL)
+
+		globalConnSet.oauth2 = &probe.OAuth2{
+			TokenURL:     tokenURL.String(),
+			ClientID:     rootFlags.clientID,
+			ClientSecret: secret,
+			Scopes:       rootFlags.scopes,
+		}
+	}
+
+	//
+	// Handle client certificate:
+	if rootFlags.keyFile != "" && rootFlags.certFile == "" {
+		check(errors.New("'--key' needs '--cert'"), ErrGetFlag)
+	}
+
+	if rootFlags.certFile != "" || rootFlags.pkcs12 != "" {
+		keyPass, err := expandEnv(rootFlags.keyPass)
+		check(err, ErrGetFlag)
+
+		var cert tls.Certificate
+		if rootFlags.pkcs12 != "" {
+			cert, err = probe.LoadPKCS12(rootFlags.pkcs12, keyPass)
+		} else {
+			cert, err = probe.LoadClientCertificate(rootFlags.certFile, rootFlags.keyFile, keyPass)
+		}
+		check(err, ErrTLS)
+
+		globalConnSet.clientCert = &cert
+		if cert.Leaf != nil {
+			pr.Debug("Client certificate: %s\n", cert.Leaf.Subject)
+		}
+	}
+
 	// create golbal request template:
 	// create template request:
 	globalRequestTemplate = WebRequest{
@@ -252,6 +417,7 @@ func PersistentPreRun(cmd *cobra.Command, args []string) {
 		method:    rootFlags.httpMethod,
 		authUser:  rootFlags.authUser,
 		authPass:  rootFlags.authPass,
+		bearer:    rootFlags.bearer,
 		reqBody:   globalRequestBody,
 		xhdrs:     globalHeaderList,
 		cookieLst: globalCookieLst,
@@ -265,3 +431,15 @@ func PersistentPreRun(cmd *cobra.Command, args []string) {
 		screenWidth = 80
 	}
 }
+
+func PersistentPostRun(cmd *cobra.Command, args []string) {
+	// persistent cookies
+	if rootFlags.cookieJarFile != "" && globalConnSet.cookieJar != nil {
+		check(globalConnSet.cookieJar.Save(rootFlags.cookieJarFile), ErrFileIO)
+	}
+
+	// failed assertions etc.
+	if globalExitCode != OK {
+		os.Exit(globalExitCode)
+	}
+}
@@ -0,0 +1,188 @@
+/*
+Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	at "github.com/hleinders/AnsiTerm"
+	"github.com/hleinders/htprobe/probe"
+)
+
+// urlResult holds the outcome of probing a single URL
+type urlResult struct {
+	job        urlJob
+	rawURL     string
+	hops       []WebRequestResult
+	err        error
+	assertions []AssertionResult
+	curl       string
+	audit      *probe.AuditReport
+	step       string
+	vars       map[string]string
+	secretVars map[string]bool
+}
+
+func (r urlResult) ok() bool {
+	return r.err == nil
+}
+
+func (r urlResult) passed() bool {
+	return assertionsPassed(r.assertions)
+}
+
+// probeURL checks and requests a single URL, it never exits the program
+func probeURL(ctx context.Context, job urlJob, useSSL, doFollow bool) urlResult {
+	res := urlResult{job: job, rawURL: job.rawURL}
+
+	newReq := globalRequestTemplate
+	u, err := checkURL(job.rawURL, useSSL)
+	if err != nil {
+		res.err = &probe.Error{Kind: probe.KindURL, URL: job.rawURL, Err: err}
+		return res
+	}
+	newReq.url = u
+
+	if job.method != "" {
+		newReq.method = job.method
+	}
+
+	if rootFlags.asCurl {
+		res.curl = newReq.curlCommand(doFollow)
+	}
+
+	res.hops, res.err = getHops(ctx, newReq, doFollow)
+
+	if withAudit && len(res.hops) > 0 {
+		report := probe.Audit(res.hops[len(res.hops)-1].Hop)
+		res.audit = &report
+	}
+
+	// assertions were validated before, so no error here:
+	al, _ := makeAssertions(job)
+	res.assertions = evalAssertions(al, res.hops)
+
+	return res
+}
+
+// runURLs probes all URLs from the arguments and the url file through a
+// pool of rootFlags.parallel workers. The results are handed to the renderer
+// in input order as soon as they are available. A summary is printed if
+// more than one URL was given. Canceling ctx (e.g. by Ctrl-C) aborts all
+// pending requests.
+func runURLs(ctx context.Context, args []string, useSSL, doFollow bool, renderer Renderer) []urlResult {
+	jobs, err := collectJobs(args)
+	check(err, ErrFileIO)
+
+	if len(jobs) == 0 {
+		check(errors.New("no URL to probe"), ErrNoURL)
+	}
+
+	// validate assertion flags once:
+	_, err = makeAssertions(urlJob{})
+	check(err, ErrGetFlag)
+
+	results := make([]urlResult, len(jobs))
+	done := make([]chan struct{}, len(jobs))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+
+	queue := make(chan int)
+	workers := max(1, min(rootFlags.parallel, len(jobs)))
+	pr.Debug("Probing %d URL(s) with %d worker(s)\n", len(jobs), workers)
+
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := range queue {
+				results[i] = probeURL(ctx, jobs[i], useSSL, doFollow)
+				close(done[i])
+			}
+		}()
+	}
+
+	go func() {
+		for i := range jobs {
+			queue <- i
+		}
+		close(queue)
+	}()
+
+	// display in input order
+	for i := range jobs {
+		<-done[i]
+
+		renderer.Render(results[i])
+	}
+
+	renderer.Finish()
+
+	if len(jobs) > 1 {
+		printSummary(results)
+	}
+
+	// failed requests take precedence over failed assertions
+	for _, r := range results {
+		if !r.ok() {
+			globalExitCode = errorExitCode(r.err)
+			break
+		}
+		if !r.passed() && globalExitCode == OK {
+			globalExitCode = ErrAssertion
+		}
+	}
+
+	return results
+}
+
+func printSummary(results []urlResult) {
+	var failed []urlResult
+	var numAssertions, assertFailed int
+
+	for _, r := range results {
+		if !r.ok() {
+			failed = append(failed, r)
+		}
+		numAssertions += len(r.assertions)
+		if !r.passed() {
+			assertFailed++
+		}
+	}
+
+	// keep machine readable output clean
+	var out io.Writer = os.Stdout
+	if !isTextOutput() {
+		out = os.Stderr
+	}
+
+	fmtString := "%s%s   %s\n"
+
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, at.Bold("Summary:"))
+	fmt.Fprintf(out, fmtString, indentHeader, "", fmt.Sprintf("%s URLs:      %d", at.BulletChar, len(results)))
+	fmt.Fprintf(out, fmtString, indentHeader, "", fmt.Sprintf("%s Succeeded: %s", at.BulletChar, at.Green(fmt.Sprint(len(results)-len(failed)))))
+
+	failedStr := fmt.Sprint(len(failed))
+	if len(failed) > 0 {
+		failedStr = at.Red(failedStr)
+	}
+	fmt.Fprintf(out, fmtString, indentHeader, "", fmt.Sprintf("%s Failed:    %s", at.BulletChar, failedStr))
+
+	for _, r := range failed {
+		fmt.Fprintf(out, fmtString, indentHeader, "", fmt.Sprintf("    %s %s: %s", at.Larrow, r.rawURL, r.err))
+	}
+
+	if numAssertions > 0 {
+		assertStr := at.Green("0")
+		if assertFailed > 0 {
+			assertStr = at.Red(fmt.Sprint(assertFailed))
+		}
+		fmt.Fprintf(out, fmtString, indentHeader, "", fmt.Sprintf("%s Assertions failed for %s URL(s)", at.BulletChar, assertStr))
+	}
+	fmt.Fprintln(out)
+}
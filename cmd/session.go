@@ -0,0 +1,517 @@
+/*
+Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	at "github.com/hleinders/AnsiTerm"
+	"github.com/hleinders/htprobe/probe"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+type SessionFlags struct {
+	vars []string
+}
+
+var sessionFlags SessionFlags
+
+var sessionShortDesc = "Runs a script of requests sharing one cookie jar"
+
+// sessionCmd represents the session command
+var sessionCmd = &cobra.Command{
+	Use:     "session <script file>",
+	Args:    cobra.ExactArgs(1),
+	Aliases: []string{"se", "script"},
+	Short:   sessionShortDesc,
+	Long: makeHeader(lowerAppName+" session: "+sessionShortDesc) + `With command 'session', the steps of a YAML or JSON script are requested
+in order, e.g. a login followed by the pages behind it. All steps share
+one cookie jar, so a session cookie set by the login is sent with the
+following requests. Every step is shown as redirect chain.
+Values of response headers, cookies or JSON bodies can be extracted into
+variables, which are used as '{{name}}' in the url, headers, cookies and
+body of later steps:
+
+  vars:
+    user: bob
+  secrets: [csrf]
+  steps:
+    - name: login
+      method: POST
+      url: https://example.com/login
+      headers:
+        Content-Type: application/json
+      body: '{"user": "{{user}}", "password": "secret"}'
+      follow: false
+      extract:
+        csrf: header:X-Csrf-Token
+        uid: json:user.id
+    - name: account
+      url: https://example.com/account/{{uid}}
+      headers:
+        X-Csrf-Token: '{{csrf}}'
+
+Extraction sources are 'header:NAME', 'cookie:NAME', 'json:PATH' (dot
+separated keys and list indexes) and 'regex:EXPR' (first group or whole
+match of the body). Environment variables are inserted with '${NAME}',
+e.g. for passwords. Variables read from cookies or from credential headers
+like 'Authorization' are masked in the output, further ones are listed in
+'secrets'. Steps follow redirects, unless 'follow: false' is set. The
+script stops at the first failing step. Use '-' to read the script from
+stdin.
+
+Flags marked with '***' may be used multiple times.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ExecSession(cmd, args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(sessionCmd)
+	addHARFlags(sessionCmd)
+
+	// flags
+	sessionCmd.Flags().BoolVarP(&redirectFlags.showResponseCookies, "show-cookies", "d", false, "show response cookies")
+	sessionCmd.Flags().BoolVarP(&redirectFlags.showResponseHeader, "response-headers", "H", false, "show response headers")
+	sessionCmd.Flags().BoolVarP(&redirectFlags.showRequestHeader, "request-headers", "R", false, "show request headers")
+	sessionCmd.Flags().BoolVarP(&redirectFlags.showRequestCookies, "request-cookies", "Z", false, "show request cookies")
+	sessionCmd.Flags().BoolVarP(&redirectFlags.showContent, "show-content", "O", false, "show content of last hop of every step (prints to stderr)")
+	sessionCmd.Flags().BoolVarP(&redirectFlags.allHops, "all", "a", false, "show all details")
+	sessionCmd.Flags().BoolVar(&redirectFlags.showTiming, "timing", false, "show timing waterfall for every hop")
+
+	// parameter
+	sessionCmd.Flags().StringArrayVar(&sessionFlags.vars, "var", nil, "set variable (fmt: 'name=value'), overrides the script; ***")
+}
+
+// SessionScript is the content of a session file
+type SessionScript struct {
+	Vars    map[string]string `yaml:"vars"`
+	Secrets []string          `yaml:"secrets"`
+	Steps   []SessionStep     `yaml:"steps"`
+}
+
+// SessionStep is a single request of a session script. Extract maps
+// variable names to their source, e.g. 'header:Location'.
+type SessionStep struct {
+	Name    string            `yaml:"name"`
+	Method  string            `yaml:"method"`
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	Cookies map[string]string `yaml:"cookies"`
+	Body    string            `yaml:"body"`
+	Follow  *bool             `yaml:"follow"`
+	Extract map[string]string `yaml:"extract"`
+}
+
+// Sources for extracted variables
+const (
+	extractHeader = "header"
+	extractCookie = "cookie"
+	extractJSON   = "json"
+	extractRegex  = "regex"
+)
+
+// extractError is returned, if a variable is not found in the response
+type extractError struct {
+	name string
+	err  error
+}
+
+func (e *extractError) Error() string {
+	return fmt.Sprintf("variable %s: %s", e.name, e.err)
+}
+
+var sessionVarRegex = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.-]+)\s*\}\}`)
+
+func (s SessionStep) title(num int) string {
+	if s.Name != "" {
+		return s.Name
+	}
+
+	return fmt.Sprintf("step %d", num)
+}
+
+func (s SessionStep) follow() bool {
+	return s.Follow == nil || *s.Follow
+}
+
+// method returns the http method, POST if a body is given, otherwise GET
+func (s SessionStep) method() string {
+	switch {
+	case s.Method != "":
+		return strings.ToUpper(s.Method)
+	case s.Body != "":
+		return "POST"
+	default:
+		return "GET"
+	}
+}
+
+func ExecSession(cmd *cobra.Command, args []string) {
+	script, err := readSessionScript(args[0])
+	if errors.Is(err, os.ErrNotExist) {
+		check(err, ErrNoFile)
+	}
+	check(err, ErrFileIO)
+
+	vars := map[string]string{}
+	for n, v := range script.Vars {
+		vars[n] = v
+	}
+	for _, s := range sessionFlags.vars {
+		n, v := splitFirst(s, "=")
+		if strings.TrimSpace(n) == "" {
+			check(fmt.Errorf("invalid variable: %s", s), ErrGetFlag)
+		}
+		vars[strings.TrimSpace(n)] = v
+	}
+
+	check(validateSession(script, vars), ErrFileIO)
+
+	secrets := map[string]bool{}
+	for _, n := range script.Secrets {
+		secrets[n] = true
+	}
+
+	// all steps share the cookie jar
+	ensureCookieJar()
+
+	bodyMode := bodyNone
+	if redirectFlags.showContent {
+		bodyMode = bodyLast
+	}
+	renderer := newRenderer(prettyPrintChainWithContent, bodyMode)
+	var results []urlResult
+
+	for i, step := range script.Steps {
+		res := runSessionStep(cmd, i+1, step, vars, secrets)
+		results = append(results, res)
+
+		if isTextOutput() {
+			title := fmt.Sprintf("Step %d/%d: %s", i+1, len(script.Steps), at.Bold(step.title(i+1)))
+			fmt.Println()
+			fmt.Println(title)
+			fmt.Println(strings.Repeat(at.FrameOHLine, len(stripColorCodes(title))))
+		}
+
+		// request details are shown for every step
+		rqHeaderDone, rqCookiesDone = false, false
+		renderer.Render(res)
+
+		if isTextOutput() && len(res.vars) > 0 {
+			chainPrintVariables(indentHeader, "", "Variables:", res.vars, res.secretVars)
+			fmt.Println()
+		}
+
+		if !res.ok() {
+			var ee *extractError
+			if errors.As(res.err, &ee) {
+				globalExitCode = ErrResponse
+			} else {
+				globalExitCode = errorExitCode(res.err)
+			}
+			break
+		}
+	}
+
+	renderer.Finish()
+	writeHAR(results)
+}
+
+func readSessionScript(fname string) (SessionScript, error) {
+	var script SessionScript
+	var r io.Reader = os.Stdin
+
+	if fname != StdinName {
+		f, err := os.Open(fname)
+		if err != nil {
+			return script, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	// JSON is valid YAML, so one decoder reads both
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&script); err != nil {
+		return script, fmt.Errorf("%s: %w", fname, err)
+	}
+
+	if len(script.Steps) == 0 {
+		return script, fmt.Errorf("%s: no steps", fname)
+	}
+
+	return script, nil
+}
+
+// validateSession checks the script before any request is sent: every
+// step needs an url and a known method, every variable must be defined
+// before it is used.
+func validateSession(script SessionScript, vars map[string]string) error {
+	defined := map[string]bool{}
+	for n := range vars {
+		defined[n] = true
+	}
+
+	for i, step := range script.Steps {
+		where := fmt.Sprintf("step %d", i+1)
+		if step.Name != "" {
+			where += " (" + step.Name + ")"
+		}
+
+		if step.URL == "" {
+			return fmt.Errorf("%s: missing url", where)
+		}
+
+		if !findInSlice(getMethodNames(), step.method()) {
+			return fmt.Errorf("%s: unknown http method: %s", where, step.method())
+		}
+
+		texts := []string{step.URL, step.Body}
+		for n, v := range step.Headers {
+			texts = append(texts, n, v)
+		}
+		for n, v := range step.Cookies {
+			texts = append(texts, n, v)
+		}
+		for _, t := range texts {
+			if _, err := expandEnv(t); err != nil {
+				return fmt.Errorf("%s: %w", where, err)
+			}
+			for _, m := range sessionVarRegex.FindAllStringSubmatch(t, -1) {
+				if !defined[m[1]] {
+					return fmt.Errorf("%s: undefined variable: %s", where, m[1])
+				}
+			}
+		}
+
+		for n, src := range step.Extract {
+			kind, expr := splitFirst(src, ":")
+			switch kind {
+			case extractHeader, extractCookie, extractJSON:
+			case extractRegex:
+				if _, err := regexp.Compile(expr); err != nil {
+					return fmt.Errorf("%s: variable %s: %w", where, n, err)
+				}
+			default:
+				return fmt.Errorf("%s: variable %s: unknown source '%s'", where, n, src)
+			}
+			defined[n] = true
+		}
+	}
+
+	return nil
+}
+
+// expandVars replaces '${NAME}' by the environment variable and
+// '{{name}}' by the value of the variable. Both were checked by
+// validateSession before.
+func expandVars(str string, vars map[string]string) string {
+	str, _ = expandEnv(str)
+
+	return sessionVarRegex.ReplaceAllStringFunc(str, func(m string) string {
+		return vars[sessionVarRegex.FindStringSubmatch(m)[1]]
+	})
+}
+
+// runSessionStep requests a step and extracts its variables into vars.
+// Variables named in secrets or read from a secret source are marked for
+// masking.
+func runSessionStep(cmd *cobra.Command, num int, step SessionStep, vars map[string]string, secrets map[string]bool) urlResult {
+	rawURL := expandVars(step.URL, vars)
+	res := urlResult{rawURL: rawURL, step: step.title(num)}
+
+	req := globalRequestTemplate
+	req.method = step.method()
+	req.reqBody = expandVars(step.Body, vars)
+
+	// step headers and cookies are added to the global ones:
+	req.xhdrs = slices.Clone(globalHeaderList)
+	for _, n := range sortedMapKeys(step.Headers) {
+		req.xhdrs = append(req.xhdrs, expandVars(n, vars)+globalHeaderSep+expandVars(step.Headers[n], vars))
+	}
+	req.cookieLst = slices.Clone(globalCookieLst)
+	for _, n := range sortedMapKeys(step.Cookies) {
+		req.cookieLst = append(req.cookieLst, &http.Cookie{Name: expandVars(n, vars), Value: expandVars(step.Cookies[n], vars)})
+	}
+
+	u, err := checkURL(rawURL, false)
+	if err != nil {
+		res.err = &probe.Error{Kind: probe.KindURL, URL: rawURL, Err: err}
+		return res
+	}
+	req.url = u
+
+	if rootFlags.asCurl {
+		res.curl = req.curlCommand(step.follow())
+	}
+
+	res.hops, res.err = getHops(cmd.Context(), req, step.follow())
+	if res.err != nil || len(res.hops) == 0 {
+		return res
+	}
+
+	for _, n := range sortedMapKeys(step.Extract) {
+		val, err := extractValue(res.hops, step.Extract[n])
+		if err != nil {
+			res.err = &extractError{name: n, err: err}
+			return res
+		}
+
+		vars[n] = val
+		if res.vars == nil {
+			res.vars = map[string]string{}
+			res.secretVars = map[string]bool{}
+		}
+		res.vars[n] = val
+		if secrets[n] || isSecretSource(step.Extract[n]) {
+			res.secretVars[n] = true
+		}
+	}
+
+	return res
+}
+
+// isSecretSource reports whether an extraction source reads a cookie or a
+// header carrying credentials
+func isSecretSource(src string) bool {
+	kind, expr := splitFirst(src, ":")
+
+	switch kind {
+	case extractCookie:
+		return true
+	case extractHeader:
+		return probe.IsSecretHeader(expr) || http.CanonicalHeaderKey(expr) == "Set-Cookie"
+	}
+
+	return false
+}
+
+// extractValue reads a value from the response of the last hop. Cookies
+// are searched in all hops, starting with the last one.
+func extractValue(hops []WebRequestResult, src string) (string, error) {
+	last := hops[len(hops)-1]
+	kind, expr := splitFirst(src, ":")
+
+	switch kind {
+	case extractHeader:
+		if vl := last.Response.Header.Values(expr); len(vl) > 0 {
+			return vl[0], nil
+		}
+		return "", fmt.Errorf("no response header %s", expr)
+
+	case extractCookie:
+		for i := len(hops) - 1; i >= 0; i-- {
+			for _, c := range hops[i].Response.Cookies() {
+				if c.Name == expr {
+					return c.Value, nil
+				}
+			}
+		}
+		for _, c := range last.Cookies {
+			if c.Name == expr {
+				return c.Value, nil
+			}
+		}
+		return "", fmt.Errorf("no cookie %s", expr)
+
+	case extractJSON:
+		return jsonPathValue(last.Body, expr)
+
+	case extractRegex:
+		m := regexp.MustCompile(expr).FindSubmatch(last.Body)
+		switch {
+		case m == nil:
+			return "", fmt.Errorf("no match for %s", expr)
+		case len(m) > 1:
+			return string(m[1]), nil
+		default:
+			return string(m[0]), nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown source '%s'", src)
+}
+
+// jsonPathValue returns the value at a dot separated path like
+// 'items.0.id' of a JSON document. Strings and numbers are returned as
+// they are, objects and lists as JSON.
+func jsonPathValue(body []byte, path string) (string, error) {
+	var node any
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&node); err != nil {
+		return "", fmt.Errorf("body is not json: %w", err)
+	}
+
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path != "" {
+		for _, key := range strings.Split(path, ".") {
+			switch n := node.(type) {
+			case map[string]any:
+				v, ok := n[key]
+				if !ok {
+					return "", fmt.Errorf("no json key %s", key)
+				}
+				node = v
+			case []any:
+				idx, err := strconv.Atoi(key)
+				if err != nil || idx < 0 || idx >= len(n) {
+					return "", fmt.Errorf("no json index %s", key)
+				}
+				node = n[idx]
+			default:
+				return "", fmt.Errorf("no json key %s", key)
+			}
+		}
+	}
+
+	switch v := node.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case nil:
+		return "", errors.New("json value is null")
+	default:
+		b, err := json.Marshal(v)
+		return string(b), err
+	}
+}
+
+func sortedMapKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// function used by session module
+func chainPrintVariables(indent, frameChar, titleMsg string, vars map[string]string, secret map[string]bool) {
+	fmtString := "%s%s   %s\n"
+	fmt.Printf(fmtString, indent, frameChar, at.Bold(titleMsg))
+
+	shown := displayVariables(vars, secret)
+	for _, n := range sortedMapKeys(shown) {
+		line := shorten(rootFlags.long, screenWidth-15, fmt.Sprintf("%s %s = %s", at.BulletChar, n, shown[n]))
+		fmt.Printf(fmtString, indent, frameChar, line)
+	}
+}
@@ -0,0 +1,120 @@
+/*
+Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	at "github.com/hleinders/AnsiTerm"
+	"github.com/hleinders/htprobe/probe"
+	"github.com/spf13/cobra"
+)
+
+type TimingFlags struct {
+	follow bool
+}
+
+var timingFlags TimingFlags
+
+var timingShortDesc = "Shows a timing breakdown (DNS, connect, TLS, TTFB, transfer) of a http request"
+
+// timingCmd represents the timing command
+var timingCmd = &cobra.Command{
+	Use:     "timing <URL> [<URL> ...]",
+	Args:    urlArgs,
+	Aliases: []string{"tm", "time"},
+	Short:   timingShortDesc,
+	Long: makeHeader(lowerAppName+" timing: "+timingShortDesc) + `With command 'timing', the duration of every phase of a http
+request is shown as a waterfall: name resolution, tcp connect, tls
+handshake, waiting for the first byte and content transfer.
+You may pass the '-f|--follow' flag to follow redirects. In this case,
+the timing of any hop is displayed. Phases may be missing, if a
+connection is reused.
+URLs may also be read from a file with '--url-file' or from stdin
+with '-' as URL.
+
+Flags marked with '***' may be used multiple times.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ExecTiming(cmd, args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(timingCmd)
+	addURLFileFlag(timingCmd)
+	addAssertionFlags(timingCmd)
+
+	// flags
+	timingCmd.Flags().BoolVarP(&timingFlags.follow, "follow", "f", false, "show timing for all hops")
+}
+
+func ExecTiming(cmd *cobra.Command, args []string) {
+	renderer := newRenderer(prettyPrintTiming, bodyNone)
+
+	runURLs(cmd.Context(), args, false, timingFlags.follow, renderer)
+}
+
+func fmtDuration(d time.Duration) string {
+	return fmt.Sprintf("%9.2f ms", durationMs(d))
+}
+
+func chainPrintTiming(indent, frameChar, mark, titleMsg string, tm probe.Timing) {
+	const barWidth = 30
+
+	fmtString := "%s%s   %s\n"
+	fmt.Printf(fmtString, indent, frameChar, at.Bold(titleMsg))
+
+	barChar, barSpace := "█", " "
+	if rootFlags.ascii {
+		barChar = "#"
+	}
+
+	total := tm.Total()
+	for _, p := range tm.Phases() {
+		bar := ""
+		if total > 0 {
+			pos := int(int64(barWidth) * int64(p.Offset) / int64(total))
+			length := int(int64(barWidth) * int64(p.Duration) / int64(total))
+			if p.Duration > 0 && length == 0 {
+				length = 1
+			}
+			if pos+length > barWidth {
+				pos = barWidth - length
+			}
+			bar = strings.Repeat(barSpace, pos) + at.Cyan(strings.Repeat(barChar, length)) + strings.Repeat(barSpace, barWidth-pos-length)
+		}
+		fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("%s %-15s %s  %s%s%s", mark, p.Name+":", fmtDuration(p.Duration), vbar, bar, vbar))
+	}
+
+	fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("%s %-15s %s", mark, "Total:", at.Bold(fmtDuration(total))))
+
+	if tm.RemoteAddr != "" {
+		conn := tm.RemoteAddr
+		if tm.ConnReused {
+			conn += " (reused)"
+		}
+		fmt.Printf(fmtString, indent, frameChar, fmt.Sprintf("%s %-15s %s", mark, "Connection:", conn))
+	}
+
+	fmt.Printf("%s%s\n", indent, frameChar)
+}
+
+func prettyPrintTiming(resultList []WebRequestResult) {
+
+	fmt.Println()
+
+	for cnt, h := range resultList {
+
+		title := fmt.Sprintf("%d:  %s (%s)", cnt+1, h.PrettyPrintRedir(cnt), colorStatus(h.Response.StatusCode))
+		titleLen := len(stripColorCodes(title))
+
+		fmt.Println(title)
+		fmt.Println(strings.Repeat(at.FrameOHLine, titleLen))
+		fmt.Println()
+		chainPrintTiming(indentHeader, "", at.BulletChar, "Timing:", h.Timing)
+		fmt.Println()
+	}
+}
@@ -0,0 +1,155 @@
+/*
+Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
+*/
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// StdinName is used as URL argument or url file name to read from stdin
+const StdinName = "-"
+
+var urlFileName string
+
+// urlJob is a single URL to probe, optionally with per-line overrides
+// from an url file
+type urlJob struct {
+	rawURL       string
+	method       string
+	expectStatus int
+	source       string
+}
+
+// addURLFileFlag adds the '--url-file' flag to a subcommand
+func addURLFileFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&urlFileName, "url-file", "", "read URLs from `file` ('"+StdinName+"' for stdin), one per line: 'URL [method=M] [status=N]'")
+}
+
+// urlArgs requires at least one URL, either as argument or from an url file
+func urlArgs(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 && urlFileName == "" {
+		return errors.New("requires at least 1 URL or '--url-file'")
+	}
+
+	return nil
+}
+
+// collectJobs builds the list of URLs to probe from the command line
+// arguments and the url file. An argument of '-' reads URLs from stdin.
+func collectJobs(args []string) ([]urlJob, error) {
+	var jobs []urlJob
+	stdinDone := false
+
+	readFrom := func(name string) error {
+		if name == StdinName {
+			if stdinDone {
+				return nil
+			}
+			stdinDone = true
+			fj, err := readURLList(os.Stdin, "stdin")
+			jobs = append(jobs, fj...)
+			return err
+		}
+
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		fj, err := readURLList(f, name)
+		jobs = append(jobs, fj...)
+		return err
+	}
+
+	for _, a := range args {
+		if a == StdinName {
+			if err := readFrom(StdinName); err != nil {
+				return jobs, err
+			}
+			continue
+		}
+		jobs = append(jobs, urlJob{rawURL: a, source: "argument"})
+	}
+
+	if urlFileName != "" {
+		if err := readFrom(urlFileName); err != nil {
+			return jobs, err
+		}
+	}
+
+	return jobs, nil
+}
+
+// readURLList parses lines of the form 'URL [key=value ...]'. Empty lines
+// and everything after a '#' at the start of a word are ignored.
+func readURLList(r io.Reader, name string) ([]urlJob, error) {
+	var jobs []urlJob
+
+	lineNo := 0
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		lineNo++
+
+		fields := strings.Fields(sc.Text())
+		for i, f := range fields {
+			if strings.HasPrefix(f, "#") {
+				fields = fields[:i]
+				break
+			}
+		}
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		job := urlJob{rawURL: fields[0], source: fmt.Sprintf("%s:%d", name, lineNo)}
+		for _, f := range fields[1:] {
+			if err := job.setOption(f); err != nil {
+				return jobs, fmt.Errorf("%s: %w", job.source, err)
+			}
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs, sc.Err()
+}
+
+// setOption handles a per-line override of the form 'key=value'
+func (j *urlJob) setOption(opt string) error {
+	key, val := splitFirst(opt, "=")
+	key = strings.ToLower(strings.TrimSpace(key))
+	val = strings.TrimSpace(val)
+
+	switch key {
+	case "method":
+		m := strings.ToUpper(val)
+		if !findInSlice(getMethodNames(), m) {
+			return fmt.Errorf("unknown http method: %s", val)
+		}
+		if methodNeedsBody(m) && globalRequestBody == "" {
+			return fmt.Errorf("http method needs body: %s", m)
+		}
+		j.method = m
+	case "status":
+		stat, err := strconv.Atoi(val)
+		if err != nil || stat < 100 || stat > 999 {
+			return fmt.Errorf("invalid status: %s", val)
+		}
+		j.expectStatus = stat
+	default:
+		return fmt.Errorf("unknown option: %s", opt)
+	}
+
+	return nil
+}
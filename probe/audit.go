@@ -0,0 +1,399 @@
+/*
+Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
+*/
+package probe
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// AuditGrade is the result of a single security check
+type AuditGrade string
+
+const (
+	GradePass AuditGrade = "pass"
+	GradeWarn AuditGrade = "warn"
+	GradeFail AuditGrade = "fail"
+	GradeInfo AuditGrade = "info"
+)
+
+// Recommended minimum for HSTS max-age: 180 days, preload requires a year
+const (
+	HSTSMinMaxAge     = 180 * 24 * 3600
+	HSTSPreloadMaxAge = 365 * 24 * 3600
+)
+
+// AuditCheck is the evaluation of a security header or cookie
+type AuditCheck struct {
+	Name    string     `json:"name"`
+	Grade   AuditGrade `json:"grade"`
+	Value   string     `json:"value,omitempty"`
+	Message string     `json:"message"`
+}
+
+// AuditReport holds all checks of a response with an overall score (0-100)
+// and grade (A-F)
+type AuditReport struct {
+	URL    string       `json:"url"`
+	Score  int          `json:"score"`
+	Grade  string       `json:"grade"`
+	Checks []AuditCheck `json:"checks"`
+}
+
+// Audit evaluates the security headers and cookie flags of hop's response
+func Audit(hop Hop) AuditReport {
+	resp := hop.Response
+	isTLS := resp.Request.URL.Scheme == "https"
+
+	report := AuditReport{URL: resp.Request.URL.String()}
+	add := func(c AuditCheck) {
+		report.Checks = append(report.Checks, c)
+	}
+
+	if isTLS {
+		add(AuditCheck{Name: "HTTPS", Grade: GradePass, Message: "served over https"})
+	} else {
+		add(AuditCheck{Name: "HTTPS", Grade: GradeFail, Message: "served over plain http"})
+	}
+
+	add(auditHSTS(resp.Header, isTLS))
+	add(auditCSP(resp.Header))
+	add(auditContentTypeOptions(resp.Header))
+	add(auditFraming(resp.Header))
+	add(auditReferrerPolicy(resp.Header))
+	add(auditPermissionsPolicy(resp.Header))
+	add(auditEnum(resp.Header, "Cross-Origin-Opener-Policy", []string{"same-origin", "same-origin-allow-popups"}))
+	add(auditEnum(resp.Header, "Cross-Origin-Embedder-Policy", []string{"require-corp", "credentialless"}))
+	add(auditEnum(resp.Header, "Cross-Origin-Resource-Policy", []string{"same-origin", "same-site"}))
+
+	for _, c := range hop.SetCookies() {
+		add(auditCookie(c, isTLS))
+	}
+
+	report.Score, report.Grade = auditScore(report.Checks)
+
+	return report
+}
+
+// auditScore rates pass with 2, warn with 1 and fail with 0 points
+func auditScore(checks []AuditCheck) (int, string) {
+	var points, total int
+
+	for _, c := range checks {
+		switch c.Grade {
+		case GradePass:
+			points += 2
+		case GradeWarn:
+			points++
+		case GradeInfo:
+			continue
+		}
+		total += 2
+	}
+
+	if total == 0 {
+		return 0, "F"
+	}
+
+	score := 100 * points / total
+	switch {
+	case score >= 90:
+		return score, "A"
+	case score >= 75:
+		return score, "B"
+	case score >= 60:
+		return score, "C"
+	case score >= 45:
+		return score, "D"
+	case score >= 30:
+		return score, "E"
+	default:
+		return score, "F"
+	}
+}
+
+// directives splits a header value like 'a=1; b' (or 'a 1 2; b' for csp)
+// into lower case names and values
+func directives(value, nameSep string) map[string]string {
+	dm := map[string]string{}
+
+	for _, d := range strings.Split(value, ";") {
+		name, val, _ := strings.Cut(strings.TrimSpace(d), nameSep)
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		// the first occurrence counts
+		if _, ok := dm[name]; !ok {
+			dm[name] = strings.Trim(strings.TrimSpace(val), `"`)
+		}
+	}
+
+	return dm
+}
+
+func auditHSTS(hdr http.Header, isTLS bool) AuditCheck {
+	const name = "Strict-Transport-Security"
+	value := hdr.Get(name)
+	c := AuditCheck{Name: name, Value: value}
+
+	switch {
+	case !isTLS:
+		c.Grade, c.Message = GradeInfo, "ignored by browsers over http"
+		return c
+	case value == "":
+		c.Grade, c.Message = GradeFail, "missing"
+		return c
+	}
+
+	d := directives(value, "=")
+	maxAge, err := strconv.Atoi(d["max-age"])
+	_, subDomains := d["includesubdomains"]
+	_, preload := d["preload"]
+
+	var notes []string
+	switch {
+	case err != nil:
+		c.Grade = GradeFail
+		notes = append(notes, "invalid or missing max-age")
+	case maxAge < HSTSMinMaxAge:
+		c.Grade = GradeWarn
+		notes = append(notes, fmt.Sprintf("max-age below %d days", HSTSMinMaxAge/86400))
+	default:
+		c.Grade = GradePass
+		notes = append(notes, fmt.Sprintf("max-age %d days", maxAge/86400))
+	}
+
+	if subDomains {
+		notes = append(notes, "includeSubDomains")
+	} else {
+		notes = append(notes, "without includeSubDomains")
+	}
+
+	if preload {
+		if maxAge < HSTSPreloadMaxAge || !subDomains {
+			c.Grade = GradeWarn
+			notes = append(notes, "preload requires max-age >= 1 year and includeSubDomains")
+		} else {
+			notes = append(notes, "preload")
+		}
+	}
+
+	c.Message = strings.Join(notes, ", ")
+
+	return c
+}
+
+func auditCSP(hdr http.Header) AuditCheck {
+	const name = "Content-Security-Policy"
+	value := hdr.Get(name)
+	c := AuditCheck{Name: name, Value: value}
+
+	if value == "" {
+		if ro := hdr.Get(name + "-Report-Only"); ro != "" {
+			c.Value = ro
+			c.Grade, c.Message = GradeWarn, "report only, not enforced"
+			return c
+		}
+		c.Grade, c.Message = GradeFail, "missing"
+		return c
+	}
+
+	var notes []string
+	restricted := false
+	for _, dir := range []string{"script-src", "default-src"} {
+		src, ok := directives(value, " ")[dir]
+		if !ok {
+			continue
+		}
+		restricted = true
+		for _, tok := range []string{"'unsafe-inline'", "'unsafe-eval'"} {
+			if strings.Contains(src, tok) {
+				notes = append(notes, dir+" allows "+tok)
+			}
+		}
+		for _, s := range strings.Fields(src) {
+			if s == "*" || s == "http:" || s == "https:" || s == "data:" {
+				notes = append(notes, dir+" allows "+s)
+			}
+		}
+		// only the first effective directive counts
+		break
+	}
+
+	switch {
+	case !restricted:
+		// e.g. only 'frame-ancestors', scripts are not limited
+		c.Grade, c.Message = GradeWarn, "no script-src/default-src"
+	case len(notes) > 0:
+		c.Grade, c.Message = GradeWarn, strings.Join(notes, ", ")
+	default:
+		c.Grade, c.Message = GradePass, "present"
+	}
+
+	return c
+}
+
+func auditContentTypeOptions(hdr http.Header) AuditCheck {
+	const name = "X-Content-Type-Options"
+	value := hdr.Get(name)
+	c := AuditCheck{Name: name, Value: value}
+
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "nosniff":
+		c.Grade, c.Message = GradePass, "mime sniffing disabled"
+	case "":
+		c.Grade, c.Message = GradeFail, "missing"
+	default:
+		c.Grade, c.Message = GradeFail, "invalid value, must be 'nosniff'"
+	}
+
+	return c
+}
+
+func auditFraming(hdr http.Header) AuditCheck {
+	c := AuditCheck{Name: "X-Frame-Options"}
+
+	if fa, ok := directives(hdr.Get("Content-Security-Policy"), " ")["frame-ancestors"]; ok {
+		c.Name, c.Value = "frame-ancestors", fa
+		if strings.Contains(fa, "*") {
+			c.Grade, c.Message = GradeWarn, "csp frame-ancestors allows any origin"
+		} else {
+			c.Grade, c.Message = GradePass, "framing restricted by csp"
+		}
+		return c
+	}
+
+	c.Value = hdr.Get(c.Name)
+	switch v := strings.ToUpper(strings.TrimSpace(c.Value)); {
+	case v == "DENY", v == "SAMEORIGIN":
+		c.Grade, c.Message = GradePass, "framing restricted"
+	case strings.HasPrefix(v, "ALLOW-FROM"):
+		c.Grade, c.Message = GradeWarn, "ALLOW-FROM is not supported by modern browsers, use csp frame-ancestors"
+	case v == "":
+		c.Grade, c.Message = GradeFail, "missing, no csp frame-ancestors either"
+	default:
+		c.Grade, c.Message = GradeFail, "invalid value"
+	}
+
+	return c
+}
+
+func auditReferrerPolicy(hdr http.Header) AuditCheck {
+	const name = "Referrer-Policy"
+	value := hdr.Get(name)
+	c := AuditCheck{Name: name, Value: value}
+
+	// with a list of policies, the last known one is used
+	policies := strings.Split(value, ",")
+	policy := strings.ToLower(strings.TrimSpace(policies[len(policies)-1]))
+
+	switch policy {
+	case "":
+		c.Grade, c.Message = GradeWarn, "missing, browser default is used"
+	case "unsafe-url", "no-referrer-when-downgrade":
+		c.Grade, c.Message = GradeWarn, "leaks full URLs to other origins"
+	case "no-referrer", "same-origin", "strict-origin", "strict-origin-when-cross-origin", "origin", "origin-when-cross-origin":
+		c.Grade, c.Message = GradePass, "restrictive"
+	default:
+		c.Grade, c.Message = GradeFail, "unknown policy"
+	}
+
+	return c
+}
+
+func auditPermissionsPolicy(hdr http.Header) AuditCheck {
+	const name = "Permissions-Policy"
+	value := hdr.Get(name)
+	c := AuditCheck{Name: name, Value: value}
+
+	switch {
+	case value != "":
+		c.Grade, c.Message = GradePass, "present"
+	case hdr.Get("Feature-Policy") != "":
+		c.Value = hdr.Get("Feature-Policy")
+		c.Grade, c.Message = GradeWarn, "only deprecated Feature-Policy"
+	default:
+		c.Grade, c.Message = GradeWarn, "missing"
+	}
+
+	return c
+}
+
+// auditEnum passes, if the header has one of the good values
+func auditEnum(hdr http.Header, name string, good []string) AuditCheck {
+	value := hdr.Get(name)
+	c := AuditCheck{Name: name, Value: value}
+
+	v := strings.ToLower(strings.TrimSpace(value))
+	// ignore parameters like 'report-to'
+	v, _, _ = strings.Cut(v, ";")
+
+	switch {
+	case v == "":
+		c.Grade, c.Message = GradeWarn, "missing"
+	case containsString(good, strings.TrimSpace(v)):
+		c.Grade, c.Message = GradePass, "restrictive"
+	default:
+		c.Grade, c.Message = GradeWarn, "permissive"
+	}
+
+	return c
+}
+
+func auditCookie(ck SetCookie, isTLS bool) AuditCheck {
+	c := AuditCheck{Name: "Cookie " + ck.Name, Grade: GradePass}
+
+	var flags, notes []string
+	worse := func(g AuditGrade, note string) {
+		notes = append(notes, note)
+		if g == GradeFail || c.Grade == GradePass {
+			c.Grade = g
+		}
+	}
+
+	if ck.Secure {
+		flags = append(flags, "Secure")
+	} else if isTLS {
+		worse(GradeFail, "missing Secure")
+	}
+
+	if ck.HttpOnly {
+		flags = append(flags, "HttpOnly")
+	} else {
+		worse(GradeWarn, "missing HttpOnly")
+	}
+
+	if ck.SameSite != "" {
+		flags = append(flags, "SameSite="+ck.SameSite)
+	} else {
+		worse(GradeWarn, "missing SameSite")
+	}
+
+	// prefix and attribute violations:
+	for _, is := range ck.Issues {
+		worse(GradeFail, is)
+	}
+
+	c.Value = strings.Join(flags, "; ")
+	if len(notes) == 0 {
+		c.Message = "flags ok"
+	} else {
+		c.Message = strings.Join(notes, ", ")
+	}
+
+	return c
+}
+
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,72 @@
+/*
+Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
+*/
+package probe
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"strings"
+	"time"
+)
+
+// Certificate is a summary of a x509 server certificate
+type Certificate struct {
+	CommonName        string
+	RawCommonName     string
+	SANs              []string
+	ValidFrom         time.Time
+	ValidUntil        time.Time
+	Organization      string
+	OrganizationUnits string
+	Country           string
+	IsCA              bool
+	IssuerName        string
+	IssuerOrg         string
+	IssuerOU          string
+	IssuerCountry     string
+}
+
+// NewCertificate creates the summary of rawCert. CommonName is lower case.
+func NewCertificate(rawCert *x509.Certificate) Certificate {
+	var c Certificate
+
+	c.RawCommonName = rawCert.Subject.CommonName
+	c.CommonName = strings.ToLower(strings.TrimSpace(c.RawCommonName))
+	c.SANs = rawCert.DNSNames
+	c.ValidFrom = rawCert.NotBefore
+	c.ValidUntil = rawCert.NotAfter
+	c.IsCA = rawCert.IsCA
+
+	c.Organization = strings.Join(rawCert.Subject.Organization, ", ")
+	c.OrganizationUnits = strings.Join(rawCert.Subject.OrganizationalUnit, ", ")
+	c.Country = strings.Join(rawCert.Subject.Country, ", ")
+
+	c.IssuerName = rawCert.Issuer.CommonName
+	c.IssuerOrg = strings.Join(rawCert.Issuer.Organization, ", ")
+	c.IssuerOU = strings.Join(rawCert.Issuer.OrganizationalUnit, ", ")
+	c.IssuerCountry = strings.Join(rawCert.Issuer.Country, ", ")
+
+	return c
+}
+
+// PeerCertificates returns the summaries of the certificates sent by the
+// server, the leaf certificate first
+func PeerCertificates(state *tls.ConnectionState) []Certificate {
+	var certs []Certificate
+
+	if state == nil {
+		return certs
+	}
+
+	for _, c := range state.PeerCertificates {
+		certs = append(certs, NewCertificate(c))
+	}
+
+	return certs
+}
+
+// DaysLeft returns the number of days until the certificate expires
+func (c Certificate) DaysLeft() int {
+	return int(time.Until(c.ValidUntil).Hours() / 24)
+}
@@ -0,0 +1,192 @@
+/*
+Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
+*/
+package probe
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/youmark/pkcs8"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// ClientAuth describes the client certificate request of a server during
+// the tls handshake of a hop
+type ClientAuth struct {
+	// Requested is set, if the server asked for a client certificate
+	Requested bool
+	// AcceptableCAs are the distinguished names of the CAs advertised by
+	// the server; empty means any CA
+	AcceptableCAs []string
+	// Sent is set, if a client certificate was sent
+	Sent bool
+}
+
+// clientAuthKey is the context key of the clientAuthRecorder of a request
+type clientAuthKey struct{}
+
+// clientAuthRecorder collects the client certificate request of the
+// handshake started by a request
+type clientAuthRecorder struct {
+	mu        sync.Mutex
+	handshake bool
+	ca        ClientAuth
+}
+
+func (r *clientAuthRecorder) record(ca ClientAuth) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ca = ca
+}
+
+func (r *clientAuthRecorder) startHandshake() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handshake = true
+}
+
+// result returns nil, if the request did not do a tls handshake (e.g.
+// plain http or a reused connection)
+func (r *clientAuthRecorder) result() *ClientAuth {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.handshake {
+		return nil
+	}
+	ca := r.ca
+
+	return &ca
+}
+
+// getClientCertificate answers the certificate request of a server with
+// the configured client certificate or an empty one and records the
+// request for the hop
+func (c *Client) getClientCertificate(cri *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	cert := c.opts.ClientCertificate
+
+	if rec, ok := cri.Context().Value(clientAuthKey{}).(*clientAuthRecorder); ok {
+		ca := ClientAuth{Requested: true, Sent: cert != nil}
+		for _, dn := range cri.AcceptableCAs {
+			ca.AcceptableCAs = append(ca.AcceptableCAs, distinguishedName(dn))
+		}
+		rec.record(ca)
+	}
+
+	// like crypto/tls, the certificate is sent even if it does not match
+	// the acceptable CAs, the server decides
+	if cert == nil {
+		return &tls.Certificate{}, nil
+	}
+
+	return cert, nil
+}
+
+// distinguishedName formats a DER encoded name
+func distinguishedName(der []byte) string {
+	var rdn pkix.RDNSequence
+	if _, err := asn1.Unmarshal(der, &rdn); err != nil {
+		return fmt.Sprintf("(invalid name: %x)", der)
+	}
+
+	var name pkix.Name
+	name.FillFromRDNSequence(&rdn)
+
+	return name.String()
+}
+
+// LoadClientCertificate reads a client certificate and its private key from
+// PEM files. If keyFile is empty, the key is read from certFile. An
+// encrypted PKCS#8 key is decrypted with password.
+func LoadClientCertificate(certFile, keyFile, password string) (tls.Certificate, error) {
+	if keyFile == "" {
+		keyFile = certFile
+	}
+
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	keyPEM, err = decryptPEMKey(keyPEM, password)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("%s: %w", keyFile, err)
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("%s: %w", certFile, err)
+	}
+
+	return cert, nil
+}
+
+// decryptPEMKey returns the first private key of data as unencrypted PEM
+func decryptPEMKey(data []byte, password string) ([]byte, error) {
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return nil, errors.New("no private key found")
+		}
+
+		switch {
+		case block.Type == "ENCRYPTED PRIVATE KEY":
+			if password == "" {
+				return nil, errors.New("private key is encrypted, password missing")
+			}
+			key, err := pkcs8.ParsePKCS8PrivateKey(block.Bytes, []byte(password))
+			if err != nil {
+				return nil, err
+			}
+			der, err := x509.MarshalPKCS8PrivateKey(key)
+			if err != nil {
+				return nil, err
+			}
+			return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+
+		// the legacy encryption of RFC 1423 is insecure by design
+		case block.Headers["Proc-Type"] == "4,ENCRYPTED":
+			return nil, errors.New("legacy encrypted private key not supported, convert it with 'openssl pkcs8 -topk8'")
+
+		case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+			return pem.EncodeToMemory(block), nil
+		}
+	}
+}
+
+// LoadPKCS12 reads a client certificate, its private key and the CA chain
+// from a PKCS#12 (.p12, .pfx) file
+func LoadPKCS12(file, password string) (tls.Certificate, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	key, leaf, chain, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("%s: %w", file, err)
+	}
+
+	cert := tls.Certificate{PrivateKey: key, Leaf: leaf}
+	cert.Certificate = append(cert.Certificate, leaf.Raw)
+	for _, c := range chain {
+		cert.Certificate = append(cert.Certificate, c.Raw)
+	}
+
+	return cert, nil
+}
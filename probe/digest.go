@@ -0,0 +1,199 @@
+/*
+Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
+*/
+package probe
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+)
+
+// digestHashes are the supported algorithms of RFC 7616, the '-sess'
+// variants use the same hash
+var digestHashes = map[string]func() hash.Hash{
+	"MD5":         md5.New,
+	"SHA-256":     sha256.New,
+	"SHA-512-256": sha512.New512_256,
+}
+
+// digestChallenge is a parsed 'WWW-Authenticate: Digest' header
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	userhash  bool
+}
+
+// findDigestChallenge returns the first digest challenge of hdr with a
+// supported algorithm
+func findDigestChallenge(hdr http.Header) (digestChallenge, bool) {
+	for _, value := range hdr.Values("Www-Authenticate") {
+		for _, params := range digestParamLists(value) {
+			dc := digestChallenge{
+				realm:     params["realm"],
+				nonce:     params["nonce"],
+				opaque:    params["opaque"],
+				algorithm: strings.ToUpper(params["algorithm"]),
+				userhash:  strings.EqualFold(params["userhash"], "true"),
+			}
+			if dc.algorithm == "" {
+				dc.algorithm = "MD5"
+			}
+
+			// prefer 'auth', 'auth-int' is only used if it is the only one
+			for _, q := range strings.Split(params["qop"], ",") {
+				q = strings.ToLower(strings.TrimSpace(q))
+				if q == "auth" || (q == "auth-int" && dc.qop == "") {
+					dc.qop = q
+				}
+			}
+
+			if _, ok := digestHashes[strings.TrimSuffix(dc.algorithm, "-SESS")]; ok && dc.nonce != "" {
+				return dc, true
+			}
+		}
+	}
+
+	return digestChallenge{}, false
+}
+
+// digestParamLists splits a header value, that may contain challenges of
+// several schemes, and returns the parameters of every digest challenge
+func digestParamLists(value string) []map[string]string {
+	var lists []map[string]string
+	var params map[string]string
+
+	rest := strings.TrimSpace(value)
+	for rest != "" {
+		// a token without '=' starts a new challenge
+		tok := rest
+		if i := strings.IndexAny(rest, " =,"); i >= 0 {
+			tok = rest[:i]
+		}
+		if !strings.HasPrefix(strings.TrimLeft(rest[len(tok):], " "), "=") {
+			params = nil
+			if strings.EqualFold(tok, "Digest") {
+				params = map[string]string{}
+				lists = append(lists, params)
+			}
+			rest = strings.TrimLeft(rest[len(tok):], " ,")
+			continue
+		}
+
+		// name=value or name="quoted, value"
+		name := strings.ToLower(tok)
+		rest = strings.TrimLeft(strings.TrimLeft(rest[len(tok):], " ")[1:], " ")
+
+		var val string
+		if strings.HasPrefix(rest, `"`) {
+			var sb strings.Builder
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				sb.WriteByte(rest[i])
+			}
+			val = sb.String()
+			rest = rest[min(i+1, len(rest)):]
+		} else {
+			i := strings.IndexByte(rest, ',')
+			if i < 0 {
+				i = len(rest)
+			}
+			val = strings.TrimSpace(rest[:i])
+			rest = rest[i:]
+		}
+
+		if params != nil {
+			params[name] = val
+		}
+		rest = strings.TrimLeft(rest, " ,")
+	}
+
+	return lists
+}
+
+// newCnonce returns a random client nonce
+func newCnonce() string {
+	cnonce := make([]byte, 16)
+	rand.Read(cnonce)
+
+	return hex.EncodeToString(cnonce)
+}
+
+// authorization computes the 'Authorization' header value for a request
+// (RFC 7616 section 3.4)
+func (dc digestChallenge) authorization(user, password, method, uri, cn string, body []byte) string {
+	newHash := digestHashes[strings.TrimSuffix(dc.algorithm, "-SESS")]
+	h := func(s string) string {
+		hh := newHash()
+		hh.Write([]byte(s))
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+
+	const nc = "00000001"
+
+	ha1 := h(user + ":" + dc.realm + ":" + password)
+	if strings.HasSuffix(dc.algorithm, "-SESS") {
+		ha1 = h(ha1 + ":" + dc.nonce + ":" + cn)
+	}
+
+	ha2 := h(method + ":" + uri)
+	if dc.qop == "auth-int" {
+		ha2 = h(method + ":" + uri + ":" + h(string(body)))
+	}
+
+	var response string
+	if dc.qop == "" {
+		response = h(ha1 + ":" + dc.nonce + ":" + ha2)
+	} else {
+		response = h(ha1 + ":" + dc.nonce + ":" + nc + ":" + cn + ":" + dc.qop + ":" + ha2)
+	}
+
+	username := user
+	if dc.userhash {
+		username = h(user + ":" + dc.realm)
+	}
+
+	quote := func(s string) string {
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+	}
+
+	parts := []string{
+		"username=" + quote(username),
+		"realm=" + quote(dc.realm),
+		"uri=" + quote(uri),
+		"algorithm=" + dc.algorithm,
+		"nonce=" + quote(dc.nonce),
+	}
+	if dc.qop != "" {
+		parts = append(parts, "nc="+nc, "cnonce="+quote(cn), "qop="+dc.qop)
+	}
+	parts = append(parts, "response="+quote(response))
+	if dc.opaque != "" {
+		parts = append(parts, "opaque="+quote(dc.opaque))
+	}
+	if dc.userhash {
+		parts = append(parts, "userhash=true")
+	}
+
+	return "Digest " + strings.Join(parts, ", ")
+}
+
+func (dc digestChallenge) String() string {
+	if dc.qop == "" {
+		return fmt.Sprintf("digest auth: %s", dc.algorithm)
+	}
+
+	return fmt.Sprintf("digest auth: %s, qop=%s", dc.algorithm, dc.qop)
+}
@@ -0,0 +1,119 @@
+/*
+Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
+*/
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// ErrorKind is the category of a failed request
+type ErrorKind int
+
+const (
+	KindUnknown ErrorKind = iota
+	KindTimeout
+	KindDNS
+	KindTLS
+	KindConnection
+	KindLocation
+	KindTooManyRedirects
+	KindURL
+	KindCanceled
+	KindAuth
+	KindRedirectLoop
+)
+
+var errorKindNames = map[ErrorKind]string{
+	KindUnknown:          "request error",
+	KindTimeout:          "timeout",
+	KindDNS:              "dns error",
+	KindTLS:              "tls error",
+	KindConnection:       "connection error",
+	KindLocation:         "bad location",
+	KindTooManyRedirects: "too many redirects",
+	KindURL:              "invalid url",
+	KindCanceled:         "canceled",
+	KindAuth:             "auth error",
+	KindRedirectLoop:     "redirect loop",
+}
+
+func (k ErrorKind) String() string {
+	return errorKindNames[k]
+}
+
+// Error is returned by Probe for any failed request
+type Error struct {
+	Kind ErrorKind
+	URL  string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Kind, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// KindOf returns the category of err, KindUnknown if err is no *Error
+func KindOf(err error) ErrorKind {
+	var pe *Error
+
+	if errors.As(err, &pe) {
+		return pe.Kind
+	}
+
+	return KindUnknown
+}
+
+// wrapError wraps err as *Error with a detected category, an existing
+// *Error is returned unchanged
+func wrapError(rawURL string, err error) error {
+	var pe *Error
+
+	if err == nil {
+		return nil
+	}
+
+	if errors.As(err, &pe) {
+		return err
+	}
+
+	return &Error{Kind: classifyError(err), URL: rawURL, Err: err}
+}
+
+// classifyError detects the category of errors from net/http
+func classifyError(err error) ErrorKind {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var opErr *net.OpError
+	var verifyErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var authErr x509.UnknownAuthorityError
+	var hostErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return KindCanceled
+	case errors.As(err, &dnsErr):
+		return KindDNS
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return KindTimeout
+	case errors.As(err, &verifyErr), errors.As(err, &recordErr), errors.As(err, &alertErr),
+		errors.As(err, &authErr), errors.As(err, &hostErr), errors.As(err, &invalidErr):
+		return KindTLS
+	case errors.As(err, &opErr):
+		return KindConnection
+	default:
+		return KindUnknown
+	}
+}
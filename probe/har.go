@@ -0,0 +1,341 @@
+/*
+Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
+*/
+package probe
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// HARVersion is the version of the HAR format written by NewHAR
+const HARVersion = "1.2"
+
+// HAR is a http archive (see http://www.softwareishard.com/blog/har-12-spec/)
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Pages   []HARPage  `json:"pages,omitempty"`
+	Entries []HAREntry `json:"entries"`
+	Comment string     `json:"comment,omitempty"`
+}
+
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type HARPage struct {
+	StartedDateTime string         `json:"startedDateTime"`
+	ID              string         `json:"id"`
+	Title           string         `json:"title"`
+	PageTimings     HARPageTimings `json:"pageTimings"`
+	Comment         string         `json:"comment,omitempty"`
+}
+
+type HARPageTimings struct {
+	OnContentLoad float64 `json:"onContentLoad"`
+	OnLoad        float64 `json:"onLoad"`
+}
+
+type HAREntry struct {
+	PageRef         string      `json:"pageref,omitempty"`
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+	ServerIPAddress string      `json:"serverIPAddress,omitempty"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARCookie    `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARCookie    `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HARCookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Path     string `json:"path,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+	HTTPOnly bool   `json:"httpOnly,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+}
+
+type HARPostData struct {
+	MimeType string         `json:"mimeType"`
+	Params   []HARNameValue `json:"params"`
+	Text     string         `json:"text"`
+}
+
+type HARContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// HARTimings are in milliseconds, -1 if not applicable. Connect includes
+// the tls handshake (ssl).
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// NewHAR returns an empty archive created by name and version
+func NewHAR(name, version string) *HAR {
+	return &HAR{Log: HARLog{
+		Version: HARVersion,
+		Creator: HARCreator{Name: name, Version: version},
+		Entries: []HAREntry{},
+	}}
+}
+
+// ReadHAR parses a http archive, e.g. exported from browser devtools
+func ReadHAR(r io.Reader) (*HAR, error) {
+	var h HAR
+
+	if err := json.NewDecoder(r).Decode(&h); err != nil {
+		return nil, fmt.Errorf("invalid HAR: %w", err)
+	}
+
+	return &h, nil
+}
+
+// AddChain adds all hops of chain as entries of a new page titled title.
+// Response bodies longer than bodyLimit bytes are truncated (0 = no body,
+// negative = no limit).
+func (h *HAR) AddChain(title string, chain Chain, bodyLimit int) {
+	id := fmt.Sprintf("page_%d", len(h.Log.Pages)+1)
+	page := HARPage{
+		ID:          id,
+		Title:       title,
+		PageTimings: HARPageTimings{OnContentLoad: -1, OnLoad: -1},
+	}
+
+	if len(chain.Hops) > 0 {
+		page.StartedDateTime = harTime(chain.Hops[0].Timing.Start)
+	} else {
+		page.StartedDateTime = harTime(time.Now())
+	}
+	h.Log.Pages = append(h.Log.Pages, page)
+
+	for _, hop := range chain.Hops {
+		entry := NewHAREntry(hop, bodyLimit)
+		entry.PageRef = id
+		h.Log.Entries = append(h.Log.Entries, entry)
+	}
+}
+
+// NewHAREntry converts a single hop
+func NewHAREntry(hop Hop, bodyLimit int) HAREntry {
+	tm := hop.Timing
+	req := hop.Request
+	resp := hop.Response
+
+	entry := HAREntry{
+		StartedDateTime: harTime(tm.Start),
+		Time:            harMs(tm.Total()),
+		Timings:         harTimings(tm),
+		Comment:         strings.Join(append(append([]string(nil), hop.Notes...), hop.Warnings...), ", "),
+	}
+
+	if host, _, err := net.SplitHostPort(tm.RemoteAddr); err == nil {
+		entry.ServerIPAddress = host
+	}
+
+	entry.Request = HARRequest{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		HTTPVersion: resp.Proto,
+		Cookies:     harCookies(req.Cookies()),
+		Headers:     harHeaders(req.Header),
+		QueryString: []HARNameValue{},
+		HeadersSize: -1,
+		BodySize:    0,
+	}
+
+	for _, k := range sortedKeys(req.URL.Query()) {
+		for _, v := range req.URL.Query()[k] {
+			entry.Request.QueryString = append(entry.Request.QueryString, HARNameValue{Name: k, Value: v})
+		}
+	}
+
+	// the request body can be read again, if it was a string:
+	if req.GetBody != nil {
+		if rc, err := req.GetBody(); err == nil {
+			body, _ := io.ReadAll(rc)
+			rc.Close()
+			entry.Request.BodySize = len(body)
+			entry.Request.PostData = &HARPostData{
+				MimeType: req.Header.Get("Content-Type"),
+				Params:   []HARNameValue{},
+				Text:     string(body),
+			}
+		}
+	}
+
+	entry.Response = HARResponse{
+		Status:      resp.StatusCode,
+		StatusText:  statusText(resp),
+		HTTPVersion: resp.Proto,
+		Cookies:     harCookies(resp.Cookies()),
+		Headers:     harHeaders(resp.Header),
+		Content:     harContent(hop.Body, resp.Header.Get("Content-Type"), bodyLimit),
+		RedirectURL: resp.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    len(hop.Body),
+	}
+
+	return entry
+}
+
+// statusText returns the reason phrase sent by the server. HTTP/2 has
+// none, so the standard text of the code is used.
+func statusText(resp *http.Response) string {
+	if text := strings.TrimSpace(strings.TrimPrefix(resp.Status, fmt.Sprint(resp.StatusCode))); text != "" {
+		return text
+	}
+
+	return http.StatusText(resp.StatusCode)
+}
+
+func harContent(body []byte, mimeType string, limit int) HARContent {
+	content := HARContent{Size: len(body), MimeType: mimeType}
+	isText := utf8.Valid(body)
+
+	if limit >= 0 && len(body) > limit {
+		body = body[:limit]
+		// do not cut a multibyte char:
+		for isText && len(body) > 0 && !utf8.Valid(body) {
+			body = body[:len(body)-1]
+		}
+		content.Comment = fmt.Sprintf("truncated to %d of %d bytes", len(body), content.Size)
+	}
+
+	if isText {
+		content.Text = string(body)
+	} else {
+		content.Text = base64.StdEncoding.EncodeToString(body)
+		content.Encoding = "base64"
+	}
+
+	return content
+}
+
+func harTimings(tm Timing) HARTimings {
+	t := HARTimings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1, Send: 0}
+
+	if !tm.DNSDone.IsZero() {
+		t.DNS = harMs(tm.DNS())
+	}
+	if !tm.ConnectDone.IsZero() {
+		t.Connect = harMs(tm.Connect() + tm.TLS())
+	}
+	if !tm.TLSDone.IsZero() {
+		t.SSL = harMs(tm.TLS())
+	}
+	if !tm.GotConn.IsZero() && !tm.WroteRequest.IsZero() {
+		t.Send = harMs(span(tm.GotConn, tm.WroteRequest))
+	}
+	t.Wait = harMs(tm.Wait())
+	t.Receive = harMs(tm.Transfer())
+
+	return t
+}
+
+func harHeaders(hdr http.Header) []HARNameValue {
+	list := []HARNameValue{}
+
+	for _, k := range sortedKeys(hdr) {
+		for _, v := range hdr[k] {
+			list = append(list, HARNameValue{Name: k, Value: v})
+		}
+	}
+
+	return list
+}
+
+func harCookies(cookies []*http.Cookie) []HARCookie {
+	list := []HARCookie{}
+
+	for _, c := range cookies {
+		hc := HARCookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Path:     c.Path,
+			Domain:   c.Domain,
+			HTTPOnly: c.HttpOnly,
+			Secure:   c.Secure,
+		}
+		if !c.Expires.IsZero() {
+			hc.Expires = harTime(c.Expires)
+		}
+		list = append(list, hc)
+	}
+
+	return list
+}
+
+func harTime(t time.Time) string {
+	return t.Format("2006-01-02T15:04:05.000Z07:00")
+}
+
+func harMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,29 @@
+/*
+Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
+*/
+package probe
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestStatusText(t *testing.T) {
+	tests := []struct {
+		status string
+		code   int
+		want   string
+	}{
+		{"200 OK", 200, "OK"},
+		{"302 Moved Temporarily", 302, "Moved Temporarily"},
+		{"404 Nicht gefunden", 404, "Nicht gefunden"},
+		{"200", 200, "OK"},
+		{"", 204, "No Content"},
+	}
+
+	for _, tt := range tests {
+		if got := statusText(&http.Response{Status: tt.status, StatusCode: tt.code}); got != tt.want {
+			t.Errorf("statusText(%q) = %q, want %q", tt.status, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,376 @@
+/*
+Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
+*/
+package probe
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Cookie jar file formats
+const (
+	JarNetscape = "netscape"
+	JarJSON     = "json"
+)
+
+const netscapeHeader = "# Netscape HTTP Cookie File"
+const httpOnlyPrefix = "#HttpOnly_"
+
+// JarEntry is a cookie stored in a Jar with all attributes needed to save
+// and restore it. A zero Expires marks a session cookie.
+type JarEntry struct {
+	Name     string    `json:"name"`
+	Value    string    `json:"value"`
+	Domain   string    `json:"domain"`
+	HostOnly bool      `json:"host_only"`
+	Path     string    `json:"path"`
+	Secure   bool      `json:"secure"`
+	HttpOnly bool      `json:"http_only"`
+	Expires  time.Time `json:"expires,omitzero"`
+}
+
+func (e JarEntry) id() string {
+	return e.Domain + ";" + e.Path + ";" + e.Name
+}
+
+func (e JarEntry) expired(now time.Time) bool {
+	return !e.Expires.IsZero() && !e.Expires.After(now)
+}
+
+// Jar is a http.CookieJar, that can be saved to and loaded from a file.
+// Matching of domains, paths and expiry is done by net/http/cookiejar, the
+// Jar only keeps track of the entries for persistence. It is safe for
+// concurrent use.
+type Jar struct {
+	jar     *cookiejar.Jar
+	mu      sync.Mutex
+	entries map[string]JarEntry
+}
+
+// NewJar returns an empty Jar using the public suffix list
+func NewJar() (*Jar, error) {
+	cj, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Jar{jar: cj, entries: map[string]JarEntry{}}, nil
+}
+
+// Cookies implements http.CookieJar
+func (j *Jar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+// SetCookies implements http.CookieJar
+func (j *Jar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.jar.SetCookies(u, cookies)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	for _, c := range cookies {
+		e := JarEntry{
+			Name:     c.Name,
+			Value:    c.Value,
+			Domain:   strings.ToLower(strings.TrimPrefix(c.Domain, ".")),
+			Path:     c.Path,
+			Secure:   c.Secure,
+			HttpOnly: c.HttpOnly,
+		}
+
+		if e.Domain == "" {
+			e.Domain = strings.ToLower(u.Hostname())
+			e.HostOnly = true
+		}
+
+		if e.Path == "" || !strings.HasPrefix(e.Path, "/") {
+			e.Path = defaultPath(u.Path)
+		}
+
+		switch {
+		case c.MaxAge < 0:
+			e.Expires = now
+		case c.MaxAge > 0:
+			e.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+		case !c.Expires.IsZero():
+			e.Expires = c.Expires
+		}
+
+		// the jar ignores cookies for foreign domains, so do we:
+		if !containsCookie(j.jar.Cookies(entryURL(e)), e) && !e.expired(now) {
+			continue
+		}
+
+		if e.expired(now) {
+			delete(j.entries, e.id())
+		} else {
+			j.entries[e.id()] = e
+		}
+	}
+}
+
+// Entries returns all unexpired cookies sorted by domain, path and name
+func (j *Jar) Entries() []JarEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	list := []JarEntry{}
+	for _, e := range j.entries {
+		if !e.expired(now) {
+			list = append(list, e)
+		}
+	}
+
+	sort.Slice(list, func(a, b int) bool {
+		return list[a].id() < list[b].id()
+	})
+
+	return list
+}
+
+// Add stores entries, e.g. read from a file, in the jar
+func (j *Jar) Add(entries []JarEntry) {
+	for _, e := range entries {
+		c := &http.Cookie{
+			Name:     e.Name,
+			Value:    e.Value,
+			Path:     e.Path,
+			Secure:   e.Secure,
+			HttpOnly: e.HttpOnly,
+			Expires:  e.Expires,
+		}
+		if !e.HostOnly {
+			c.Domain = e.Domain
+		}
+
+		j.SetCookies(entryURL(e), []*http.Cookie{c})
+	}
+}
+
+// Load reads a cookie file in Netscape or JSON format. A missing file is
+// not an error, so the same file can be used for loading and saving.
+func (j *Jar) Load(fname string) error {
+	f, err := os.Open(fname)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	var entries []JarEntry
+	if start, _ := br.Peek(1); len(start) > 0 && (start[0] == '[' || start[0] == '{') {
+		entries, err = ReadJSONCookies(br)
+	} else {
+		entries, err = ReadNetscapeCookies(br)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", fname, err)
+	}
+
+	j.Add(entries)
+
+	return nil
+}
+
+// Save writes all cookies to fname. The format is JSON, if fname ends
+// with '.json', otherwise Netscape.
+func (j *Jar) Save(fname string) error {
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+
+	if JarFormat(fname) == JarJSON {
+		err = WriteJSONCookies(f, j.Entries())
+	} else {
+		err = WriteNetscapeCookies(f, j.Entries())
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// JarFormat returns the file format for fname
+func JarFormat(fname string) string {
+	if strings.EqualFold(filepath.Ext(fname), ".json") {
+		return JarJSON
+	}
+
+	return JarNetscape
+}
+
+// ReadNetscapeCookies parses the cookies.txt format of curl and wget:
+// domain, subdomains flag, path, secure flag, expiry (unix time, 0 for
+// session cookies), name and value separated by tabs
+func ReadNetscapeCookies(r io.Reader) ([]JarEntry, error) {
+	var list []JarEntry
+
+	lineNo := 0
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimRight(sc.Text(), "\r")
+
+		httpOnly := false
+		if strings.HasPrefix(line, httpOnlyPrefix) {
+			httpOnly = true
+			line = strings.TrimPrefix(line, httpOnlyPrefix)
+		}
+
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) == 6 {
+			// empty value
+			fields = append(fields, "")
+		}
+		if len(fields) != 7 {
+			return list, fmt.Errorf("line %d: expected 7 tab separated fields", lineNo)
+		}
+
+		exp, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return list, fmt.Errorf("line %d: invalid expiry: %s", lineNo, fields[4])
+		}
+
+		e := JarEntry{
+			Domain:   strings.ToLower(strings.TrimPrefix(fields[0], ".")),
+			HostOnly: !strings.EqualFold(fields[1], "TRUE"),
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			HttpOnly: httpOnly,
+			Name:     fields[5],
+			Value:    fields[6],
+		}
+		if exp > 0 {
+			e.Expires = time.Unix(exp, 0)
+		}
+
+		list = append(list, e)
+	}
+
+	return list, sc.Err()
+}
+
+// WriteNetscapeCookies writes entries in the cookies.txt format
+func WriteNetscapeCookies(w io.Writer, entries []JarEntry) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "%s\n# This file was generated by htprobe. Edit at your own risk.\n\n", netscapeHeader)
+
+	tf := func(b bool) string {
+		if b {
+			return "TRUE"
+		}
+		return "FALSE"
+	}
+
+	for _, e := range entries {
+		domain := e.Domain
+		if !e.HostOnly {
+			domain = "." + domain
+		}
+		if e.HttpOnly {
+			domain = httpOnlyPrefix + domain
+		}
+
+		var exp int64
+		if !e.Expires.IsZero() {
+			exp = e.Expires.Unix()
+		}
+
+		fmt.Fprintf(bw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", domain, tf(!e.HostOnly), e.Path, tf(e.Secure), exp, e.Name, e.Value)
+	}
+
+	return bw.Flush()
+}
+
+// ReadJSONCookies reads a list of entries or a single entry
+func ReadJSONCookies(r io.Reader) ([]JarEntry, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	if s := strings.TrimSpace(string(raw)); strings.HasPrefix(s, "{") {
+		var e JarEntry
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return nil, err
+		}
+		return []JarEntry{e}, nil
+	}
+
+	var list []JarEntry
+	err := json.Unmarshal(raw, &list)
+
+	return list, err
+}
+
+// WriteJSONCookies writes entries as indented JSON list
+func WriteJSONCookies(w io.Writer, entries []JarEntry) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(entries)
+}
+
+// defaultPath is the cookie path for a request path (RFC 6265 5.1.4)
+func defaultPath(p string) string {
+	if p == "" || p[0] != '/' {
+		return "/"
+	}
+
+	i := strings.LastIndex(p, "/")
+	if i == 0 {
+		return "/"
+	}
+
+	return p[:i]
+}
+
+// entryURL is an URL, the cookie of e is set for and sent to
+func entryURL(e JarEntry) *url.URL {
+	scheme := "http"
+	if e.Secure {
+		scheme = "https"
+	}
+
+	return &url.URL{Scheme: scheme, Host: e.Domain, Path: e.Path}
+}
+
+func containsCookie(list []*http.Cookie, e JarEntry) bool {
+	for _, c := range list {
+		if c.Name == e.Name && c.Value == e.Value {
+			return true
+		}
+	}
+
+	return false
+}
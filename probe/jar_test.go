@@ -0,0 +1,133 @@
+/*
+Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
+*/
+package probe
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testEntries cover host-only, domain, secure, HttpOnly, session cookies
+// and empty values
+func testEntries() []JarEntry {
+	exp := time.Unix(time.Now().Add(24*time.Hour).Unix(), 0)
+
+	return []JarEntry{
+		{Name: "sid", Value: "42", Domain: "example.com", HostOnly: true, Path: "/", Secure: true, HttpOnly: true, Expires: exp},
+		{Name: "lang", Value: "de", Domain: "example.com", Path: "/app", Expires: exp},
+		{Name: "empty", Value: "", Domain: "www.example.org", HostOnly: true, Path: "/"},
+	}
+}
+
+func equalEntries(t *testing.T, got, want []JarEntry) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if !g.Expires.Equal(w.Expires) {
+			t.Errorf("entry %d: expires %v, want %v", i, g.Expires, w.Expires)
+		}
+		g.Expires, w.Expires = time.Time{}, time.Time{}
+		if g != w {
+			t.Errorf("entry %d: %+v, want %+v", i, g, w)
+		}
+	}
+}
+
+func TestNetscapeRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteNetscapeCookies(&buf, testEntries()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(buf.String(), netscapeHeader) {
+		t.Errorf("missing header: %q", buf.String())
+	}
+
+	got, err := ReadNetscapeCookies(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equalEntries(t, got, testEntries())
+}
+
+func TestReadNetscapeCookiesCurl(t *testing.T) {
+	// written by 'curl -c'
+	const file = "# Netscape HTTP Cookie File\n" +
+		"# https://curl.se/docs/http-cookies.html\n" +
+		"# This file was generated by libcurl! Edit at your own risk.\n" +
+		"\n" +
+		"#HttpOnly_example.com\tFALSE\t/\tTRUE\t0\tsid\t42\n" +
+		".example.com\tTRUE\t/app\tFALSE\t1893456000\tlang\tde\r\n"
+
+	got, err := ReadNetscapeCookies(strings.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	equalEntries(t, got, []JarEntry{
+		{Name: "sid", Value: "42", Domain: "example.com", HostOnly: true, Path: "/", Secure: true, HttpOnly: true},
+		{Name: "lang", Value: "de", Domain: "example.com", Path: "/app", Expires: time.Unix(1893456000, 0)},
+	})
+}
+
+func TestReadNetscapeCookiesInvalid(t *testing.T) {
+	for _, line := range []string{"example.com\tFALSE\t/\n", "example.com\tFALSE\t/\tFALSE\tsoon\tn\tv\n"} {
+		if _, err := ReadNetscapeCookies(strings.NewReader(line)); err == nil {
+			t.Errorf("ReadNetscapeCookies(%q) succeeded", line)
+		}
+	}
+}
+
+func TestJarSaveLoad(t *testing.T) {
+	for _, fname := range []string{"cookies.txt", "cookies.json"} {
+		t.Run(fname, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), fname)
+
+			jar, err := NewJar()
+			if err != nil {
+				t.Fatal(err)
+			}
+			jar.Add(testEntries())
+			if err := jar.Save(path); err != nil {
+				t.Fatal(err)
+			}
+
+			loaded, err := NewJar()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := loaded.Load(path); err != nil {
+				t.Fatal(err)
+			}
+
+			equalEntries(t, loaded.Entries(), jar.Entries())
+		})
+	}
+}
+
+func TestJarLoadJSONObject(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "obj.json")
+	data := `{"name": "sid", "value": "42", "domain": "example.com", "host_only": true, "path": "/"}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	jar, err := NewJar()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := jar.Load(path); err != nil {
+		t.Fatal(err)
+	}
+
+	equalEntries(t, jar.Entries(), []JarEntry{{Name: "sid", Value: "42", Domain: "example.com", HostOnly: true, Path: "/"}})
+}
@@ -0,0 +1,100 @@
+/*
+Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
+*/
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenExpiryMargin renews a token shortly before it expires
+const tokenExpiryMargin = 10 * time.Second
+
+// OAuth2 fetches access tokens with the client credentials grant
+// (RFC 6749 section 4.4) and caches them until they expire. It is safe for
+// concurrent use, so a single OAuth2 can be shared by many Clients.
+type OAuth2 struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// tokenResponse is the successful answer of a token endpoint
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// Token returns the cached access token or fetches a new one through hc.
+// A zero expiry keeps the token for the lifetime of o.
+func (o *OAuth2) Token(ctx context.Context, hc *http.Client) (string, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.token != "" && (o.expires.IsZero() || time.Now().Before(o.expires)) {
+		return o.token, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(o.Scopes) > 0 {
+		form.Set("scope", strings.Join(o.Scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", &Error{Kind: KindAuth, URL: o.TokenURL, Err: err}
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	// client authentication (RFC 6749 section 2.3.1)
+	req.SetBasicAuth(url.QueryEscape(o.ClientID), url.QueryEscape(o.ClientSecret))
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		return "", wrapError(o.TokenURL, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", wrapError(o.TokenURL, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &Error{Kind: KindAuth, URL: o.TokenURL, Err: fmt.Errorf("token request failed: %s", resp.Status)}
+	}
+
+	var tr tokenResponse
+	if err := json.Unmarshal(body, &tr); err != nil {
+		return "", &Error{Kind: KindAuth, URL: o.TokenURL, Err: fmt.Errorf("invalid token response: %w", err)}
+	}
+	if tr.AccessToken == "" {
+		return "", &Error{Kind: KindAuth, URL: o.TokenURL, Err: errors.New("no access_token in token response")}
+	}
+	if tr.TokenType != "" && !strings.EqualFold(tr.TokenType, "bearer") {
+		return "", &Error{Kind: KindAuth, URL: o.TokenURL, Err: fmt.Errorf("unsupported token type: %s", tr.TokenType)}
+	}
+
+	o.token = tr.AccessToken
+	o.expires = time.Time{}
+	if tr.ExpiresIn > 0 {
+		o.expires = time.Now().Add(time.Duration(tr.ExpiresIn)*time.Second - tokenExpiryMargin)
+	}
+
+	return o.token, nil
+}
@@ -0,0 +1,578 @@
+/*
+Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
+*/
+
+// Package probe is the request engine of htprobe. It performs http requests,
+// optionally follows the redirect chain hop by hop and records headers,
+// cookies, tls state, content and timing of every hop.
+//
+// A minimal example:
+//
+//	u, _ := url.Parse("http://example.com")
+//	chain, err := probe.Probe(context.Background(), probe.Request{URL: *u, Follow: true})
+//
+// Use New with Options to configure proxy, timeouts, cookie handling etc.
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxRedirects is used if Options.MaxRedirects is not set
+const DefaultMaxRedirects = 25
+
+// Options configure the connection setup of a Client. All timeouts are
+// disabled, if zero.
+type Options struct {
+	// Timeout limits every single request
+	Timeout time.Duration
+	// ConnectTimeout limits the tcp connect
+	ConnectTimeout time.Duration
+	// TLSHandshakeTimeout limits the tls handshake
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout limits waiting for the response headers after
+	// the request has been written
+	ResponseHeaderTimeout time.Duration
+	// MaxTime limits the whole chain
+	MaxTime time.Duration
+	// Proxy is used as http proxy, if set (fmt: host(:port))
+	Proxy string
+	// Resolve connects to the address instead of resolving the host, like
+	// curl's '--resolve' (fmt: "host:port" -> "address")
+	Resolve map[string]string
+	// Insecure trusts invalid server certificates
+	Insecure bool
+	// ClientCertificate is sent, if a server requests one (mTLS)
+	ClientCertificate *tls.Certificate
+	// DisableHTTP2 does not try HTTP/2
+	DisableHTTP2 bool
+	// Jar stores response cookies; if nil, response cookies are ignored
+	Jar http.CookieJar
+	// OAuth2 fetches a bearer token, that is sent with every hop
+	OAuth2 *OAuth2
+	// MaxRedirects limits the length of a followed chain
+	MaxRedirects int
+	// KeepMethod does not change POST to GET on 301 and 302 redirects
+	KeepMethod bool
+	// FollowMeta follows a 'Refresh' header or a HTML meta refresh of a
+	// response, that is no redirect
+	FollowMeta bool
+	// DigestOnly sends user and password only to answer a digest
+	// challenge, not as basic auth with every request
+	DigestOnly bool
+	// Debugf receives debug messages, if set
+	Debugf func(format string, args ...any)
+}
+
+// Request describes the initial request of a chain
+type Request struct {
+	URL       url.URL
+	Method    string
+	UserAgent string
+	Language  string
+	User      string
+	Password  string
+	// BearerToken is sent as 'Authorization: Bearer', if set
+	BearerToken string
+	Body        string
+	Header      http.Header
+	Cookies     []*http.Cookie
+	// Follow redirects, otherwise only a single request is done
+	Follow bool
+
+	// authorization answering a digest challenge, used for one request
+	digestAuth string
+	// credentials were dropped on a redirect to another origin
+	crossOrigin bool
+}
+
+func (r Request) String() string {
+	return fmt.Sprintf("%s (%s)", r.URL.String(), r.Method)
+}
+
+// Hop is a single request and response of a chain. The response body has
+// already been read into Body.
+type Hop struct {
+	Request  *http.Request
+	Response *http.Response
+	Body     []byte
+	// Cookies holds the content of the cookie jar for the hop's URL
+	Cookies []*http.Cookie
+	Timing  Timing
+	// MetaRefresh is set, if the hop was reached by a meta refresh or a
+	// 'Refresh' header of the previous hop instead of a redirect
+	MetaRefresh bool
+	// ClientAuth is the client certificate request of the server, nil if
+	// the hop did no tls handshake
+	ClientAuth *ClientAuth
+	// Retry is set, if the hop repeats the previous one with the
+	// credentials answering its challenge; it is no redirect
+	Retry bool
+	// Notes are remarks of the engine, e.g. about an auth retry
+	Notes []string
+	// Warnings are problems of the response, e.g. a relative Location
+	Warnings []string
+}
+
+func (h Hop) String() string {
+	return fmt.Sprintf("%s (%s)", h.Request.URL.String(), h.Response.Status)
+}
+
+// Chain holds all hops of a request, starting with the initial one
+type Chain struct {
+	Hops []Hop
+	// Loop holds the indices of the hops forming a redirect loop; the
+	// last one redirects back to the first one
+	Loop []int
+}
+
+// Last returns the final hop of the chain
+func (c Chain) Last() *Hop {
+	if len(c.Hops) == 0 {
+		return nil
+	}
+
+	return &c.Hops[len(c.Hops)-1]
+}
+
+// Client performs requests with a fixed set of options. It is safe for
+// concurrent use.
+type Client struct {
+	opts Options
+}
+
+// New returns a Client using the given options
+func New(opts Options) *Client {
+	if opts.MaxRedirects <= 0 {
+		opts.MaxRedirects = DefaultMaxRedirects
+	}
+
+	return &Client{opts: opts}
+}
+
+// Probe performs req with default options
+func Probe(ctx context.Context, req Request) (Chain, error) {
+	return New(Options{}).Probe(ctx, req)
+}
+
+// Probe performs req and, if req.Follow is set, all redirects. On failure,
+// the hops done so far are returned together with an *Error. Canceling ctx
+// aborts the chain.
+func (c *Client) Probe(ctx context.Context, req Request) (Chain, error) {
+	var chain Chain
+	var err error
+
+	if c.opts.MaxTime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.opts.MaxTime)
+		defer cancel()
+	}
+
+	hc := c.httpClient()
+	req.Cookies = append([]*http.Cookie(nil), req.Cookies...)
+	req.Header = req.Header.Clone()
+
+	if req.Follow {
+		chain, err = c.follow(ctx, hc, &req)
+	} else {
+		chain, err = c.noFollow(ctx, hc, &req)
+	}
+
+	return chain, wrapError(req.URL.String(), err)
+}
+
+// Resolve returns the IP addresses of host
+func Resolve(ctx context.Context, host string) ([]string, error) {
+	ips, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, &Error{Kind: KindDNS, URL: host, Err: err}
+	}
+
+	return ips, nil
+}
+
+func (c *Client) debugf(format string, args ...any) {
+	if c.opts.Debugf != nil {
+		c.opts.Debugf(format, args...)
+	}
+}
+
+// httpClient creates a new client (and transport) per chain, so the timing
+// of the first hop always includes the connection setup
+func (c *Client) httpClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   c.opts.ConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	dial := dialer.DialContext
+	if len(c.opts.Resolve) > 0 {
+		dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if ip, ok := c.opts.Resolve[addr]; ok {
+				_, port, _ := net.SplitHostPort(addr)
+				c.debugf("Resolve %s to %s\n", addr, ip)
+				addr = net.JoinHostPort(ip, port)
+			}
+			return dialer.DialContext(ctx, network, addr)
+		}
+	}
+
+	tr := &http.Transport{
+		DialContext:           dial,
+		TLSHandshakeTimeout:   c.opts.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: c.opts.ResponseHeaderTimeout,
+	}
+
+	if !c.opts.DisableHTTP2 {
+		tr.ForceAttemptHTTP2 = true
+	}
+
+	// always answers certificate requests to record them
+	tr.TLSClientConfig = &tls.Config{
+		InsecureSkipVerify:   c.opts.Insecure,
+		GetClientCertificate: c.getClientCertificate,
+	}
+
+	if c.opts.Proxy != "" {
+		proxy := c.opts.Proxy
+		tr.Proxy = func(*http.Request) (*url.URL, error) {
+			return url.Parse(fmt.Sprintf("http://%s", proxy))
+		}
+	}
+
+	// redirects are followed hop by hop
+	return &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+		Transport: tr,
+		Timeout:   c.opts.Timeout,
+		Jar:       c.opts.Jar,
+	}
+}
+
+func (c *Client) doRequest(ctx context.Context, client *http.Client, wr *Request) (Hop, error) {
+	var rb io.Reader
+	var hop Hop
+
+	if wr.Body != "" {
+		rb = strings.NewReader(wr.Body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, wr.Method, wr.URL.String(), rb)
+	if err != nil {
+		return hop, err
+	}
+	if len(wr.UserAgent) != 0 {
+		req.Header.Set("User-Agent", wr.UserAgent)
+	}
+
+	// reqLang?
+	if wr.Language != "" {
+		req.Header.Set("Accept-Language", wr.Language)
+	}
+
+	// Additional header
+	for n, v := range wr.Header {
+		req.Header[n] = append([]string(nil), v...)
+	}
+
+	// Auth?
+	if !c.opts.DigestOnly && wr.User != "" {
+		req.SetBasicAuth(wr.User, wr.Password)
+	}
+
+	if wr.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+wr.BearerToken)
+	}
+
+	if c.opts.OAuth2 != nil && !wr.crossOrigin {
+		token, err := c.opts.OAuth2.Token(ctx, client)
+		if err != nil {
+			return hop, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	if wr.digestAuth != "" {
+		req.Header.Set("Authorization", wr.digestAuth)
+	}
+
+	for _, c := range wr.Cookies {
+		req.AddCookie(c)
+	}
+
+	c.debugf("Client:\n%+v\n", client)
+	c.debugf("Request:\n%+v\n", req)
+	c.debugf("Cookies:\n%+v\n", client.Jar)
+
+	// trace the request phases
+	var mu sync.Mutex
+	var tm Timing
+	rec := &clientAuthRecorder{}
+
+	stamp := func(t *time.Time) {
+		mu.Lock()
+		defer mu.Unlock()
+		if t.IsZero() {
+			*t = time.Now()
+		}
+	}
+
+	trace := &httptrace.ClientTrace{
+		DNSStart:     func(httptrace.DNSStartInfo) { stamp(&tm.DNSStart) },
+		DNSDone:      func(httptrace.DNSDoneInfo) { stamp(&tm.DNSDone) },
+		ConnectStart: func(string, string) { stamp(&tm.ConnectStart) },
+		ConnectDone: func(network, addr string, err error) {
+			if err == nil {
+				stamp(&tm.ConnectDone)
+			}
+		},
+		TLSHandshakeStart: func() {
+			stamp(&tm.TLSStart)
+			rec.startHandshake()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) { stamp(&tm.TLSDone) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			stamp(&tm.GotConn)
+			mu.Lock()
+			defer mu.Unlock()
+			tm.ConnReused = info.Reused
+			if info.Conn != nil {
+				tm.RemoteAddr = info.Conn.RemoteAddr().String()
+			}
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { stamp(&tm.WroteRequest) },
+		GotFirstResponseByte: func() { stamp(&tm.FirstByte) },
+	}
+	ctx = context.WithValue(httptrace.WithClientTrace(req.Context(), trace), clientAuthKey{}, rec)
+	req = req.WithContext(ctx)
+
+	// handle request
+	tm.Start = time.Now()
+	resp, errReq := client.Do(req)
+	if errReq == nil {
+		// read the body to measure the transfer
+		hop.Body, errReq = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		stamp(&tm.Done)
+
+		mu.Lock()
+		hop.Timing = tm
+		mu.Unlock()
+
+		hop.Request = req
+		hop.Response = resp
+		hop.ClientAuth = rec.result()
+		if client.Jar != nil {
+			hop.Cookies = client.Jar.Cookies(resp.Request.URL)
+		}
+	}
+
+	if errReq != nil {
+		c.debugf("Error is: %T\n", errReq)
+		c.debugf("Error details: %+v\n", errReq)
+	}
+
+	c.debugf("Response:\n%+v\n", resp)
+
+	// check if cookie went to jar:
+	for _, ck := range hop.Cookies {
+		if findCookieInList(ck, wr.Cookies) {
+			wr.Cookies = deleteCookieFromList(ck, wr.Cookies)
+		}
+	}
+
+	return hop, errReq
+}
+
+// request does a single request and adds the hop to chain. A digest
+// challenge is answered with a second request, that is added as a hop of
+// its own.
+func (c *Client) request(ctx context.Context, hc *http.Client, wr *Request, chain *Chain) (Hop, error) {
+	hop, err := c.doRequest(ctx, hc, wr)
+	if err != nil {
+		return hop, wrapError(wr.URL.String(), err)
+	}
+
+	// add to list:
+	chain.Hops = append(chain.Hops, hop)
+	c.checkLocation(chain)
+
+	if hop.Response.StatusCode != http.StatusUnauthorized || wr.User == "" {
+		return hop, nil
+	}
+
+	dc, ok := findDigestChallenge(hop.Response.Header)
+	if !ok {
+		return hop, nil
+	}
+
+	c.debugf("Digest challenge: %+v\n", dc)
+	wr.digestAuth = dc.authorization(wr.User, wr.Password, hop.Request.Method, wr.URL.RequestURI(), newCnonce(), []byte(wr.Body))
+	defer func() { wr.digestAuth = "" }()
+
+	hop, err = c.doRequest(ctx, hc, wr)
+	if err != nil {
+		return hop, wrapError(wr.URL.String(), err)
+	}
+	hop.Retry = true
+	hop.Notes = append(hop.Notes, dc.String())
+
+	chain.Hops = append(chain.Hops, hop)
+	c.checkLocation(chain)
+
+	return hop, nil
+}
+
+// checkLocation adds the warnings about the Location of a redirect to the
+// last hop of chain
+func (c *Client) checkLocation(chain *Chain) {
+	last := chain.Last()
+	if !IsRedirect(last.Response.StatusCode) {
+		return
+	}
+
+	_, warnings, err := location(*last)
+	if err != nil {
+		c.debugf("Location: %v\n", err)
+	}
+	last.Warnings = append(last.Warnings, warnings...)
+}
+
+func (c *Client) follow(ctx context.Context, hc *http.Client, wr *Request) (Chain, error) {
+	var chain Chain
+
+	// index of the first hop of every request, for loop detection
+	visited := map[string]int{hopKey(hc, wr): 0}
+
+	// initial request
+	hop, err := c.request(ctx, hc, wr, &chain)
+	if err != nil {
+		return chain, err
+	}
+
+	cnt := 0
+	// repeat until no further redirect happens:
+	for {
+		status := hop.Response.StatusCode
+		var rdURL *url.URL
+		var notes []string
+		refresh := false
+
+		// detect next hop:
+		if IsRedirect(status) {
+			// warnings were added by request
+			var e error
+			if rdURL, _, e = location(hop); e != nil {
+				return chain, &Error{Kind: KindLocation, URL: wr.URL.String(), Err: e}
+			}
+		} else if c.opts.FollowMeta {
+			var delay int
+			if rdURL, delay, refresh = refreshURL(hop); refresh {
+				c.debugf("Refresh to %s after %ds\n", rdURL, delay)
+				// a refresh navigates like a 303
+				status = http.StatusSeeOther
+				if delay > 0 {
+					notes = append(notes, fmt.Sprintf("refresh after %ds", delay))
+				}
+			}
+		}
+
+		if rdURL == nil {
+			break
+		}
+
+		// limit reached?
+		if cnt >= c.opts.MaxRedirects {
+			e := fmt.Errorf("stopped after %d redirects", cnt)
+			return chain, &Error{Kind: KindTooManyRedirects, URL: wr.URL.String(), Err: e}
+		}
+
+		// update the request
+		notes = append(notes, c.redirect(wr, status, rdURL)...)
+
+		// been here before?
+		key := hopKey(hc, wr)
+		if i, ok := visited[key]; ok {
+			for j := i; j < len(chain.Hops); j++ {
+				chain.Loop = append(chain.Loop, j)
+			}
+			e := fmt.Errorf("hop %d redirects back to hop %d (%s)", len(chain.Hops), i+1, wr.URL.String())
+			return chain, &Error{Kind: KindRedirectLoop, URL: wr.URL.String(), Err: e}
+		}
+		visited[key] = len(chain.Hops)
+
+		// next hop:
+		hop, err = c.request(ctx, hc, wr, &chain)
+		if err != nil {
+			return chain, err
+		}
+		next := &chain.Hops[visited[key]]
+		next.Notes = append(notes, next.Notes...)
+		next.MetaRefresh = refresh
+		cnt++
+	}
+
+	return chain, nil
+}
+
+func (c *Client) noFollow(ctx context.Context, hc *http.Client, wr *Request) (Chain, error) {
+	var chain Chain
+
+	// initial and only request (and an auth retry)
+	_, err := c.request(ctx, hc, wr, &chain)
+
+	return chain, err
+}
+
+// hopKey identifies a request for loop detection: repeating a request
+// with the same method, URL and cookies leads to the same redirect again
+func hopKey(hc *http.Client, wr *Request) string {
+	var cookies []string
+
+	if hc.Jar != nil {
+		for _, c := range hc.Jar.Cookies(&wr.URL) {
+			cookies = append(cookies, c.Name+"="+c.Value)
+		}
+	}
+	for _, c := range wr.Cookies {
+		cookies = append(cookies, c.Name+"="+c.Value)
+	}
+	sort.Strings(cookies)
+
+	return wr.Method + " " + wr.URL.String() + " " + strings.Join(cookies, "; ")
+}
+
+func deleteCookieFromList(cookie *http.Cookie, list []*http.Cookie) []*http.Cookie {
+	var result []*http.Cookie
+
+	for _, c := range list {
+		if c.Name != cookie.Name {
+			result = append(result, c)
+		}
+	}
+
+	return result
+}
+
+func findCookieInList(cookie *http.Cookie, list []*http.Cookie) bool {
+	for _, c := range list {
+		if c.Name == cookie.Name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,292 @@
+/*
+Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
+*/
+package probe
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// bodyHeaders describe the request body and are dropped together with it
+var bodyHeaders = []string{"Content-Type", "Content-Length", "Content-Encoding", "Content-Language", "Content-Location"}
+
+// credentialHeaders are not sent to another origin
+var credentialHeaders = []string{"Authorization", "Cookie"}
+
+// redirect updates wr for following a redirect with status to next. The
+// method and body are changed like browsers do (RFC 9110 section 15.4),
+// credentials are dropped, if next is on another origin. The returned
+// notes describe the changes.
+func (c *Client) redirect(wr *Request, status int, next *url.URL) []string {
+	var notes []string
+
+	method := wr.Method
+	switch status {
+	case http.StatusSeeOther:
+		if method != http.MethodGet && method != http.MethodHead {
+			method = http.MethodGet
+		}
+	case http.StatusMovedPermanently, http.StatusFound:
+		if method == http.MethodPost && !c.opts.KeepMethod {
+			method = http.MethodGet
+		}
+	}
+
+	// 307 and 308 keep method and body
+	if method != wr.Method {
+		notes = append(notes, fmt.Sprintf("%s changed to %s", wr.Method, method))
+		wr.Method = method
+
+		if wr.Body != "" {
+			notes = append(notes, "body dropped")
+			wr.Body = ""
+		}
+		for _, h := range bodyHeaders {
+			wr.Header.Del(h)
+		}
+	}
+
+	if !sameOrigin(&wr.URL, next) {
+		if dropped := wr.dropCredentials(c.opts.OAuth2 != nil); len(dropped) > 0 {
+			notes = append(notes, fmt.Sprintf("%s dropped (cross-origin)", strings.Join(dropped, ", ")))
+		}
+	}
+
+	wr.URL = *next
+
+	return notes
+}
+
+// dropCredentials removes all credentials from wr and returns their names
+func (wr *Request) dropCredentials(withOAuth2 bool) []string {
+	var dropped []string
+
+	if wr.User != "" || wr.Password != "" || wr.BearerToken != "" || (withOAuth2 && !wr.crossOrigin) || wr.Header.Get("Authorization") != "" {
+		dropped = append(dropped, "Authorization")
+	}
+	if len(wr.Cookies) > 0 || wr.Header.Get("Cookie") != "" {
+		dropped = append(dropped, "request cookies")
+	}
+
+	wr.User, wr.Password, wr.BearerToken = "", "", ""
+	wr.Cookies = nil
+	for _, h := range credentialHeaders {
+		wr.Header.Del(h)
+	}
+	wr.crossOrigin = true
+
+	return dropped
+}
+
+// sameOrigin reports whether a and b have the same scheme, host and port
+func sameOrigin(a, b *url.URL) bool {
+	return strings.EqualFold(a.Scheme, b.Scheme) && strings.EqualFold(hostPort(a), hostPort(b))
+}
+
+// hostPort returns the host of u with the default port of its scheme
+func hostPort(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if strings.EqualFold(u.Scheme, "https") {
+			port = "443"
+		}
+	}
+
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// refreshURL returns the target of a 'Refresh' header or, in a HTML
+// response, of a '<meta http-equiv="refresh">' element, resolved against
+// the URL of hop, together with the delay in seconds. A refresh without URL
+// reloads the page and is ignored.
+func refreshURL(hop Hop) (*url.URL, int, bool) {
+	content, ok := hop.Response.Header.Get("Refresh"), true
+	if content == "" {
+		content, ok = metaRefresh(hop)
+	}
+	if !ok {
+		return nil, 0, false
+	}
+
+	delay, target, ok := parseRefresh(content)
+	if !ok || target == "" {
+		return nil, 0, false
+	}
+
+	u, err := hop.Request.URL.Parse(target)
+	if err != nil {
+		return nil, 0, false
+	}
+
+	return u, delay, true
+}
+
+// metaRefresh returns the content of the first meta refresh element of a
+// HTML body
+func metaRefresh(hop Hop) (string, bool) {
+	ct := hop.Response.Header.Get("Content-Type")
+	if ct != "" && !strings.Contains(strings.ToLower(ct), "html") {
+		return "", false
+	}
+
+	z := html.NewTokenizer(bytes.NewReader(hop.Body))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return "", false
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			if string(name) != "meta" || !hasAttr {
+				continue
+			}
+
+			var equiv, content string
+			var hasContent bool
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				switch string(key) {
+				case "http-equiv":
+					equiv = string(val)
+				case "content":
+					content, hasContent = string(val), true
+				}
+			}
+			if strings.EqualFold(strings.TrimSpace(equiv), "refresh") && hasContent {
+				return content, true
+			}
+		}
+	}
+}
+
+// parseRefresh splits the content of a refresh into delay and URL, e.g.
+// '5; url=/start' (HTML Living Standard, shared declarative refresh steps)
+func parseRefresh(content string) (int, string, bool) {
+	rest := strings.TrimLeft(content, " \t\n\r\f")
+
+	i := 0
+	for i < len(rest) && rest[i] >= '0' && rest[i] <= '9' {
+		i++
+	}
+	if i == 0 && (len(rest) == 0 || rest[0] != '.') {
+		return 0, "", false
+	}
+	delay, _ := strconv.Atoi(rest[:i])
+
+	// fractions are ignored, the separator may also be whitespace only
+	rest = strings.TrimLeft(rest[i:], "0123456789.")
+	if rest != "" && !strings.ContainsRune("; ,\t\n\r\f", rune(rest[0])) {
+		return 0, "", false
+	}
+	rest = strings.TrimLeft(rest, " \t\n\r\f")
+	if rest != "" && (rest[0] == ';' || rest[0] == ',') {
+		rest = rest[1:]
+	}
+	rest = strings.TrimLeft(rest, " \t\n\r\f")
+	if rest == "" {
+		return delay, "", true
+	}
+
+	// optional 'url=' prefix
+	if len(rest) >= 3 && strings.EqualFold(rest[:3], "url") {
+		if r := strings.TrimLeft(rest[3:], " \t\n\r\f"); strings.HasPrefix(r, "=") {
+			rest = strings.TrimLeft(r[1:], " \t\n\r\f")
+		}
+	}
+
+	// quoted URL
+	if rest != "" && (rest[0] == '\'' || rest[0] == '"') {
+		q := rest[0]
+		rest = rest[1:]
+		if i := strings.IndexByte(rest, q); i >= 0 {
+			rest = rest[:i]
+		}
+	}
+
+	return delay, strings.TrimSpace(rest), true
+}
+
+// IsRedirect reports whether status is a redirect, that is followed with
+// its Location header. Other 3xx (e.g. 304 Not Modified) end a chain.
+func IsRedirect(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+
+	return false
+}
+
+// location resolves the Location header of a redirect response like
+// browsers do (WHATWG URL standard) and returns warnings about unusual
+// values. A missing Location returns a nil URL.
+func location(hop Hop) (*url.URL, []string, error) {
+	var warnings []string
+
+	values := hop.Response.Header.Values("Location")
+	if len(values) == 0 || strings.TrimSpace(values[0]) == "" {
+		return nil, []string{"missing Location"}, nil
+	}
+	if len(values) > 1 {
+		warnings = append(warnings, "multiple Location headers")
+	}
+
+	// leading and trailing spaces and controls are trimmed, tabs and
+	// newlines removed
+	raw := values[0]
+	loc := strings.TrimFunc(raw, func(r rune) bool { return r <= ' ' })
+	loc = strings.NewReplacer("\t", "", "\n", "", "\r", "").Replace(loc)
+	if loc != raw || strings.Contains(loc, " ") {
+		warnings = append(warnings, "spaces in Location")
+	}
+
+	for _, r := range loc {
+		if r > unicode.MaxASCII {
+			warnings = append(warnings, "non-ASCII Location")
+			break
+		}
+	}
+
+	// backslashes are slashes in http(s) URLs
+	if strings.Contains(loc, `\`) {
+		warnings = append(warnings, "backslash in Location")
+		loc = strings.ReplaceAll(loc, `\`, "/")
+	}
+
+	if strings.Contains(loc, "#") {
+		warnings = append(warnings, "fragment in Location")
+	}
+
+	ref, err := url.Parse(loc)
+	if err != nil {
+		return nil, append(warnings, "invalid Location"), err
+	}
+
+	switch {
+	case strings.HasPrefix(loc, "//"):
+		warnings = append(warnings, "protocol-relative Location")
+	case !ref.IsAbs():
+		warnings = append(warnings, "relative Location")
+	}
+
+	u := hop.Request.URL.ResolveReference(ref)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, append(warnings, "invalid Location"), fmt.Errorf("unsupported scheme in Location: %s", loc)
+	}
+	if hop.Request.URL.Scheme == "https" && u.Scheme == "http" {
+		warnings = append(warnings, "HTTPS downgrade")
+	}
+
+	return u, warnings, nil
+}
@@ -0,0 +1,188 @@
+/*
+Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
+*/
+package probe
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// testHop returns a hop for a request of rawURL with the response headers
+func testHop(rawURL string, hdr http.Header, body string) Hop {
+	u, _ := url.Parse(rawURL)
+
+	return Hop{
+		Request:  &http.Request{URL: u},
+		Response: &http.Response{StatusCode: http.StatusFound, Header: hdr},
+		Body:     []byte(body),
+	}
+}
+
+func TestLocation(t *testing.T) {
+	tests := []struct {
+		name     string
+		from     string
+		location []string
+		want     string
+		warnings []string
+		err      bool
+	}{
+		{"absolute", "https://example.com/a", []string{"https://example.com/b"}, "https://example.com/b", nil, false},
+		{"relative", "https://example.com/a/b", []string{"c?x=1"}, "https://example.com/a/c?x=1", []string{"relative Location"}, false},
+		{"protocol-relative", "https://example.com/a", []string{"//cdn.example.com/x"}, "https://cdn.example.com/x", []string{"protocol-relative Location"}, false},
+		{"non-ASCII", "https://example.com/", []string{"https://example.com/straße"}, "https://example.com/stra%C3%9Fe", []string{"non-ASCII Location"}, false},
+		{"fragment", "https://example.com/", []string{"/b#top"}, "https://example.com/b#top", []string{"fragment in Location", "relative Location"}, false},
+		{"downgrade", "https://example.com/", []string{"http://example.com/"}, "http://example.com/", []string{"HTTPS downgrade"}, false},
+		{"backslash", "https://example.com/", []string{`\\evil.example.com\x`}, "https://evil.example.com/x", []string{"backslash in Location", "protocol-relative Location"}, false},
+		{"spaces", "https://example.com/", []string{" /b\t"}, "https://example.com/b", []string{"spaces in Location", "relative Location"}, false},
+		{"multiple", "https://example.com/", []string{"/b", "/c"}, "https://example.com/b", []string{"multiple Location headers", "relative Location"}, false},
+		{"missing", "https://example.com/", nil, "", []string{"missing Location"}, false},
+		{"scheme", "https://example.com/", []string{"javascript:alert(1)"}, "", []string{"invalid Location"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hop := testHop(tt.from, http.Header{"Location": tt.location}, "")
+
+			u, warnings, err := location(hop)
+			if (err != nil) != tt.err {
+				t.Fatalf("location() error = %v, want error %v", err, tt.err)
+			}
+
+			got := ""
+			if u != nil {
+				got = u.String()
+			}
+			if got != tt.want {
+				t.Errorf("location() = %s, want %s", got, tt.want)
+			}
+			if !reflect.DeepEqual(warnings, tt.warnings) {
+				t.Errorf("location() warnings = %q, want %q", warnings, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestParseRefresh(t *testing.T) {
+	tests := []struct {
+		content string
+		delay   int
+		url     string
+		ok      bool
+	}{
+		{"0; url=/start", 0, "/start", true},
+		{"5;URL=/start", 5, "/start", true},
+		{"3, url = /start", 3, "/start", true},
+		{"0; url='/a b'", 0, "/a b", true},
+		{`0; url="/quoted"; ignored`, 0, "/quoted", true},
+		{"0; url='/unterminated", 0, "/unterminated", true},
+		{"0; /no-prefix", 0, "/no-prefix", true},
+		{"0; urlx=/y", 0, "urlx=/y", true},
+		{"2.5; url=/fraction", 2, "/fraction", true},
+		{".5; url=/dot", 0, "/dot", true},
+		{"10", 10, "", true},
+		{"  7  ", 7, "", true},
+		{"soon; url=/x", 0, "", false},
+		{"5 url=/x", 5, "/x", true},
+		{"5x; url=/x", 0, "", false},
+		{"", 0, "", false},
+	}
+
+	for _, tt := range tests {
+		delay, u, ok := parseRefresh(tt.content)
+		if delay != tt.delay || u != tt.url || ok != tt.ok {
+			t.Errorf("parseRefresh(%q) = %d, %q, %v, want %d, %q, %v", tt.content, delay, u, ok, tt.delay, tt.url, tt.ok)
+		}
+	}
+}
+
+func TestRefreshURL(t *testing.T) {
+	html := http.Header{"Content-Type": {"text/html; charset=utf-8"}}
+
+	tests := []struct {
+		name  string
+		hdr   http.Header
+		body  string
+		want  string
+		delay int
+	}{
+		{"header", http.Header{"Refresh": {"2; url=/next"}}, "", "https://example.com/next", 2},
+		{"meta", html, `<html><head><META HTTP-EQUIV="Refresh" content="0; URL='next.html'"></head></html>`, "https://example.com/a/next.html", 0},
+		{"meta self-closing", html, `<meta http-equiv="refresh" content="1;url=https://other.example.com/"/>`, "https://other.example.com/", 1},
+		{"reload only", html, `<meta http-equiv="refresh" content="30">`, "", 0},
+		{"other meta", html, `<meta name="refresh" content="0; url=/x">`, "", 0},
+		{"not html", http.Header{"Content-Type": {"application/json"}}, `<meta http-equiv="refresh" content="0; url=/x">`, "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hop := testHop("https://example.com/a/b", tt.hdr, tt.body)
+
+			u, delay, ok := refreshURL(hop)
+			got := ""
+			if ok {
+				got = u.String()
+			}
+			if got != tt.want || delay != tt.delay {
+				t.Errorf("refreshURL() = %s, %d, want %s, %d", got, delay, tt.want, tt.delay)
+			}
+		})
+	}
+}
+
+func TestRedirectMethod(t *testing.T) {
+	tests := []struct {
+		status     int
+		method     string
+		keepMethod bool
+		want       string
+		body       string
+	}{
+		{http.StatusSeeOther, http.MethodPost, false, http.MethodGet, ""},
+		{http.StatusSeeOther, http.MethodHead, false, http.MethodHead, "a=1"},
+		{http.StatusFound, http.MethodPost, false, http.MethodGet, ""},
+		{http.StatusFound, http.MethodPost, true, http.MethodPost, "a=1"},
+		{http.StatusMovedPermanently, http.MethodPut, false, http.MethodPut, "a=1"},
+		{http.StatusTemporaryRedirect, http.MethodPost, false, http.MethodPost, "a=1"},
+		{http.StatusPermanentRedirect, http.MethodPost, false, http.MethodPost, "a=1"},
+	}
+
+	for _, tt := range tests {
+		from, _ := url.Parse("https://example.com/a")
+		next, _ := url.Parse("https://example.com/b")
+		wr := &Request{URL: *from, Method: tt.method, Body: "a=1", Header: http.Header{"Content-Type": {"application/x-www-form-urlencoded"}}}
+
+		New(Options{KeepMethod: tt.keepMethod}).redirect(wr, tt.status, next)
+		if wr.Method != tt.want || wr.Body != tt.body {
+			t.Errorf("%d %s (keep %v): got %s %q, want %s %q", tt.status, tt.method, tt.keepMethod, wr.Method, wr.Body, tt.want, tt.body)
+		}
+	}
+}
+
+func TestRedirectCrossOrigin(t *testing.T) {
+	from, _ := url.Parse("https://example.com/a")
+	wr := &Request{
+		URL:     *from,
+		Method:  http.MethodGet,
+		User:    "bob",
+		Header:  http.Header{"Authorization": {"Bearer x"}, "X-Keep": {"1"}},
+		Cookies: []*http.Cookie{{Name: "sid", Value: "42"}},
+	}
+
+	same, _ := url.Parse("https://EXAMPLE.com:443/b")
+	if notes := New(Options{}).redirect(wr, http.StatusFound, same); len(notes) != 0 || wr.User == "" {
+		t.Fatalf("same origin dropped credentials: %q", notes)
+	}
+
+	other, _ := url.Parse("https://example.com:8443/c")
+	notes := New(Options{}).redirect(wr, http.StatusFound, other)
+	if want := []string{"Authorization, request cookies dropped (cross-origin)"}; !reflect.DeepEqual(notes, want) {
+		t.Errorf("notes = %q, want %q", notes, want)
+	}
+	if wr.User != "" || wr.Cookies != nil || wr.Header.Get("Authorization") != "" || wr.Header.Get("X-Keep") != "1" {
+		t.Errorf("request after cross-origin redirect = %+v", wr)
+	}
+}
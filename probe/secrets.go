@@ -0,0 +1,109 @@
+/*
+Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
+*/
+package probe
+
+import (
+	"net/http"
+	"strings"
+)
+
+// SecretMask replaces credentials in masked output
+const SecretMask = "****"
+
+// SecretHeaders are request headers carrying credentials
+var SecretHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// IsSecretHeader reports whether name is one of the SecretHeaders
+func IsSecretHeader(name string) bool {
+	return containsString(SecretHeaders, http.CanonicalHeaderKey(name))
+}
+
+// MaskHeaderValue hides the credentials in the value of a secret header.
+// The auth scheme and the cookie names are kept, other headers are
+// returned unchanged.
+func MaskHeaderValue(name, value string) string {
+	switch http.CanonicalHeaderKey(name) {
+	case "Authorization", "Proxy-Authorization":
+		if scheme, _, ok := strings.Cut(strings.TrimSpace(value), " "); ok {
+			return scheme + " " + SecretMask
+		}
+		return SecretMask
+	case "Cookie":
+		var list []string
+		for _, c := range strings.Split(value, ";") {
+			n, _, _ := strings.Cut(strings.TrimSpace(c), "=")
+			if n != "" {
+				list = append(list, n+"="+SecretMask)
+			}
+		}
+		return strings.Join(list, "; ")
+	}
+
+	return value
+}
+
+// MaskHeader returns a copy of hdr with masked secret headers
+func MaskHeader(hdr http.Header) http.Header {
+	masked := hdr.Clone()
+
+	for name, values := range masked {
+		if !IsSecretHeader(name) {
+			continue
+		}
+		for i, v := range values {
+			values[i] = MaskHeaderValue(name, v)
+		}
+	}
+
+	return masked
+}
+
+// MaskCookies returns copies of cookies with masked values
+func MaskCookies(cookies []*http.Cookie) []*http.Cookie {
+	var masked []*http.Cookie
+
+	for _, c := range cookies {
+		mc := *c
+		mc.Value = SecretMask
+		masked = append(masked, &mc)
+	}
+
+	return masked
+}
+
+// MaskValues returns a copy of m with the values of the secret keys
+// masked, e.g. for variables holding tokens
+func MaskValues(m map[string]string, secret map[string]bool) map[string]string {
+	if m == nil {
+		return nil
+	}
+
+	masked := make(map[string]string, len(m))
+	for k, v := range m {
+		if secret[k] {
+			v = SecretMask
+		}
+		masked[k] = v
+	}
+
+	return masked
+}
+
+// MaskSecrets masks the secret headers and the cookies of all requests
+// in the archive
+func (h *HAR) MaskSecrets() {
+	for i := range h.Log.Entries {
+		req := &h.Log.Entries[i].Request
+
+		for j, hv := range req.Headers {
+			if IsSecretHeader(hv.Name) {
+				req.Headers[j].Value = MaskHeaderValue(hv.Name, hv.Value)
+			}
+		}
+
+		for j := range req.Cookies {
+			req.Cookies[j].Value = SecretMask
+		}
+	}
+}
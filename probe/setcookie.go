@@ -0,0 +1,154 @@
+/*
+Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
+*/
+package probe
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Cookie name prefixes with special rules (RFC 6265bis)
+const (
+	PrefixHost   = "__Host-"
+	PrefixSecure = "__Secure-"
+)
+
+// SetCookie is a parsed Set-Cookie response header. Issues lists
+// violations, that make browsers reject or weaken the cookie.
+type SetCookie struct {
+	Raw         string    `json:"raw"`
+	Name        string    `json:"name"`
+	Value       string    `json:"value"`
+	Path        string    `json:"path,omitempty"`
+	Domain      string    `json:"domain,omitempty"`
+	Expires     time.Time `json:"expires,omitzero"`
+	MaxAge      int       `json:"max_age,omitempty"`
+	Secure      bool      `json:"secure"`
+	HttpOnly    bool      `json:"http_only"`
+	SameSite    string    `json:"same_site,omitempty"`
+	Partitioned bool      `json:"partitioned"`
+	Prefix      string    `json:"prefix,omitempty"`
+	Issues      []string  `json:"issues,omitempty"`
+}
+
+// Expired reports whether the cookie deletes an existing one
+func (c SetCookie) Expired() bool {
+	return c.MaxAge < 0 || (!c.Expires.IsZero() && c.Expires.Before(time.Now()))
+}
+
+// Session reports whether the cookie lives until the browser is closed
+func (c SetCookie) Session() bool {
+	return c.MaxAge == 0 && c.Expires.IsZero()
+}
+
+// SetCookies parses every Set-Cookie header of the hop's response
+func (h Hop) SetCookies() []SetCookie {
+	if h.Response == nil {
+		return nil
+	}
+
+	return ParseSetCookies(h.Response.Header.Values("Set-Cookie"), h.Response.Request.URL)
+}
+
+// ParseSetCookies parses Set-Cookie header lines, that were received from
+// reqURL, and checks them for violations
+func ParseSetCookies(lines []string, reqURL *url.URL) []SetCookie {
+	list := []SetCookie{}
+
+	for _, line := range lines {
+		list = append(list, parseSetCookie(line, reqURL))
+	}
+
+	return list
+}
+
+func parseSetCookie(line string, reqURL *url.URL) SetCookie {
+	sc := SetCookie{Raw: line}
+
+	ck, err := http.ParseSetCookie(line)
+	if err != nil {
+		sc.Name, _, _ = strings.Cut(line, "=")
+		sc.Issues = append(sc.Issues, "invalid: "+err.Error())
+		return sc
+	}
+
+	sc.Name = ck.Name
+	sc.Value = ck.Value
+	sc.Path = ck.Path
+	sc.Domain = ck.Domain
+	sc.Expires = ck.Expires
+	sc.MaxAge = ck.MaxAge
+	sc.Secure = ck.Secure
+	sc.HttpOnly = ck.HttpOnly
+	sc.Partitioned = ck.Partitioned
+
+	switch ck.SameSite {
+	case http.SameSiteLaxMode:
+		sc.SameSite = "Lax"
+	case http.SameSiteStrictMode:
+		sc.SameSite = "Strict"
+	case http.SameSiteNoneMode:
+		sc.SameSite = "None"
+	}
+
+	sc.check(reqURL)
+
+	return sc
+}
+
+func (c *SetCookie) check(reqURL *url.URL) {
+	isTLS := reqURL != nil && reqURL.Scheme == "https"
+	issue := func(msg string) {
+		c.Issues = append(c.Issues, msg)
+	}
+
+	switch {
+	case strings.HasPrefix(c.Name, PrefixHost):
+		c.Prefix = PrefixHost
+		if !c.Secure {
+			issue(PrefixHost + " requires Secure")
+		}
+		if c.Domain != "" {
+			issue(PrefixHost + " must not have a Domain")
+		}
+		if c.Path != "/" {
+			issue(PrefixHost + " requires Path=/")
+		}
+	case strings.HasPrefix(c.Name, PrefixSecure):
+		c.Prefix = PrefixSecure
+		if !c.Secure {
+			issue(PrefixSecure + " requires Secure")
+		}
+	}
+
+	if c.Prefix != "" && !isTLS {
+		issue(c.Prefix + " must be set over https")
+	}
+
+	if c.Secure && reqURL != nil && !isTLS {
+		issue("Secure cookie set over http is rejected")
+	}
+
+	if c.SameSite == "None" && !c.Secure {
+		issue("SameSite=None requires Secure")
+	}
+
+	if c.Partitioned && !c.Secure {
+		issue("Partitioned requires Secure")
+	}
+
+	if c.Domain != "" && reqURL != nil && !domainMatch(reqURL.Hostname(), c.Domain) {
+		issue("Domain " + c.Domain + " does not match host " + reqURL.Hostname())
+	}
+}
+
+// domainMatch checks host against a cookie domain (RFC 6265 5.1.3)
+func domainMatch(host, domain string) bool {
+	host = strings.ToLower(host)
+	domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
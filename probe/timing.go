@@ -0,0 +1,84 @@
+/*
+Copyright © 2024 Dr. Harald Leinders <harald@leinders.de>
+*/
+package probe
+
+import "time"
+
+// Timing holds the points in time of the phases of a single request, as
+// reported by httptrace. Phases which did not happen (e.g. DNS lookup on a
+// reused connection) remain zero.
+type Timing struct {
+	Start        time.Time
+	DNSStart     time.Time
+	DNSDone      time.Time
+	ConnectStart time.Time
+	ConnectDone  time.Time
+	TLSStart     time.Time
+	TLSDone      time.Time
+	GotConn      time.Time
+	WroteRequest time.Time
+	FirstByte    time.Time
+	Done         time.Time
+	ConnReused   bool
+	RemoteAddr   string
+}
+
+// Phase is a named part of a request, Offset is relative to the start
+type Phase struct {
+	Name     string
+	Offset   time.Duration
+	Duration time.Duration
+}
+
+func span(from, to time.Time) time.Duration {
+	if from.IsZero() || to.IsZero() {
+		return 0
+	}
+
+	return to.Sub(from)
+}
+
+func (t Timing) DNS() time.Duration {
+	return span(t.DNSStart, t.DNSDone)
+}
+
+func (t Timing) Connect() time.Duration {
+	return span(t.ConnectStart, t.ConnectDone)
+}
+
+func (t Timing) TLS() time.Duration {
+	return span(t.TLSStart, t.TLSDone)
+}
+
+// Wait is the time to first byte, measured from the request being written
+func (t Timing) Wait() time.Duration {
+	return span(t.waitStart(), t.FirstByte)
+}
+
+func (t Timing) Transfer() time.Duration {
+	return span(t.FirstByte, t.Done)
+}
+
+func (t Timing) Total() time.Duration {
+	return span(t.Start, t.Done)
+}
+
+func (t Timing) waitStart() time.Time {
+	if t.WroteRequest.IsZero() {
+		return t.GotConn
+	}
+
+	return t.WroteRequest
+}
+
+// Phases returns DNS lookup, connect, tls handshake, wait and transfer
+func (t Timing) Phases() []Phase {
+	return []Phase{
+		{"DNS lookup", span(t.Start, t.DNSStart), t.DNS()},
+		{"TCP connect", span(t.Start, t.ConnectStart), t.Connect()},
+		{"TLS handshake", span(t.Start, t.TLSStart), t.TLS()},
+		{"Server (TTFB)", span(t.Start, t.waitStart()), t.Wait()},
+		{"Transfer", span(t.Start, t.FirstByte), t.Transfer()},
+	}
+}